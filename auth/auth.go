@@ -1,5 +1,7 @@
 package auth
 
+import "context"
+
 type Auth interface {
 	GetLoginUid() string
 	SetLoginUid(uid string)
@@ -25,3 +27,15 @@ func (a *auth) SetLoginUid(uid string) {
 func (a *auth) IsLogin() bool {
 	return a.LoginUid != ""
 }
+
+type contextKey struct{}
+
+// WithLoginUid returns a context carrying the login uid, which takes precedence over Auth.GetLoginUid.
+func WithLoginUid(ctx context.Context, uid string) context.Context {
+	return context.WithValue(ctx, contextKey{}, uid)
+}
+
+func LoginUidFromContext(ctx context.Context) (string, bool) {
+	uid, ok := ctx.Value(contextKey{}).(string)
+	return uid, ok
+}
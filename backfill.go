@@ -0,0 +1,88 @@
+package graphor
+
+import (
+	"context"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+const defaultBackfillBatchSize = 100
+
+type BackfillOptions struct {
+	BatchSize int                      // nodes per committed chunk (100 if 0)
+	After     string                   // resume after this uid, i.e. BackfillProgress.Cursor of an interrupted run
+	Scope     func(q Query) Query      // filters nodes to visit (optional)
+	Progress  func(p BackfillProgress) // called after each committed chunk (optional)
+}
+
+type BackfillProgress struct {
+	Cursor    string // uid of the last node committed
+	Processed int    // nodes processed in this run
+}
+
+func (g *Client) Backfill(schema Schema, opts BackfillOptions, execute func(m *Mutation, data QueryData) error) error {
+	return g.BackfillContext(context.Background(), schema, opts, execute)
+}
+
+// BackfillContext walks all (not deleted) nodes of schema.Tag in uid order and calls execute for each,
+// committing writes in chunks of opts.BatchSize through Mutate. If it fails halfway,
+// pass the last reported cursor as opts.After to resume.
+func (g *Client) BackfillContext(ctx context.Context, schema Schema, opts BackfillOptions, execute func(m *Mutation, data QueryData) error) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatchSize
+	}
+
+	cursor := opts.After
+	if cursor == "" {
+		cursor = "0x0"
+	} else if !isValidUid(cursor) {
+		return errors.New(errors.InvalidOptions, "Backfill failed: Invalid cursor.").Add("after", cursor)
+	}
+
+	progress := BackfillProgress{Cursor: cursor}
+
+	for {
+		q := g.BuildQuery(schema).(*query)
+		q.After = cursor
+
+		var scoped Query = q
+		if opts.Scope != nil {
+			scoped = q.Scope(opts.Scope)
+		}
+
+		dataList, err := scoped.Take(batchSize).AllContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(dataList) == 0 {
+			return nil
+		}
+
+		err = g.MutateContext(ctx, func(m *Mutation) error {
+			for _, data := range dataList {
+				err := execute(m, data)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		cursor = decodeString(dataList[len(dataList)-1]["uid"])
+		progress.Cursor = cursor
+		progress.Processed += len(dataList)
+
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+
+		if len(dataList) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,500 @@
+// Command graphor-gen generates boilerplate of graphor models: NewX, Xs, AsX, AsXs,
+// Save, Delete and relation accessors (HasY, LoadY).
+//
+// Run it in a package directory, typically via go generate:
+//
+//	//go:generate go run github.com/nosukeru/graphor/cmd/graphor-gen -type User,Image
+//
+// Models are structs embedding graphor.ModelProperty. Schema of model X is taken from
+// function XSchema() if defined in the package, or derived by graphor.SchemaOf otherwise.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma separated model type names; all models in package if empty")
+	output    = flag.String("output", "graphor_gen.go", "output file name")
+	dir       = flag.String("dir", ".", "package directory")
+)
+
+type model struct {
+	Name        string // User
+	Receiver    string // user
+	Plural      string // Users
+	Schema      string // expression evaluating to graphor.Schema
+	Embedded    string // embedded domain model (e.g. UserModel), empty if none
+	EmbeddedUid bool   // whether Embedded has Uid field
+	Relations   []relation
+}
+
+type relation struct {
+	Name    string // key in Schema.Relations
+	Method  string // exported name used in HasY, LoadY
+	HasMany bool
+	Target  *model // nil if target isn't generated
+	target  string
+}
+
+type pkg struct {
+	Name    string
+	structs map[string]*ast.StructType
+	funcs   map[string]*ast.FuncDecl
+	order   []string
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("graphor-gen: ")
+	flag.Parse()
+
+	p, err := parsePackage(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	models, err := p.models(*typeNames)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	command := strings.Join(append([]string{"graphor-gen"}, os.Args[1:]...), " ")
+	src, err := generate(p.Name, models, command)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(*dir, *output), src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parsePackage(dir string) (*pkg, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pkg{
+		structs: map[string]*ast.StructType{},
+		funcs:   map[string]*ast.FuncDecl{},
+	}
+	fset := token.NewFileSet()
+
+	for _, info := range files {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == *output {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		p.Name = f.Name.Name
+
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					p.funcs[d.Name.Name] = d
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						p.structs[ts.Name.Name] = st
+						p.order = append(p.order, ts.Name.Name)
+					}
+				}
+			}
+		}
+	}
+
+	if p.Name == "" {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	return p, nil
+}
+
+func (p *pkg) models(typeNames string) ([]*model, error) {
+	names := []string{}
+	if typeNames == "" {
+		for _, name := range p.order {
+			if isModel(p.structs[name]) {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, name := range strings.Split(typeNames, ",") {
+			name = strings.TrimSpace(name)
+			st, ok := p.structs[name]
+			if !ok || !isModel(st) {
+				return nil, fmt.Errorf("%s is not a struct embedding graphor.ModelProperty", name)
+			}
+			names = append(names, name)
+		}
+	}
+
+	models := []*model{}
+	byName := map[string]*model{}
+	for _, name := range names {
+		m := p.model(name)
+		models = append(models, m)
+		byName[name] = m
+	}
+
+	for _, m := range models {
+		for i := range m.Relations {
+			m.Relations[i].Target = byName[m.Relations[i].target]
+		}
+	}
+
+	return models, nil
+}
+
+func (p *pkg) model(name string) *model {
+	m := &model{
+		Name:     name,
+		Receiver: receiverName(name),
+		Plural:   plural(name),
+	}
+
+	st := p.structs[name]
+	for _, field := range st.Fields.List {
+		if ident, ok := field.Type.(*ast.Ident); ok && len(field.Names) == 0 {
+			if embedded, ok := p.structs[ident.Name]; ok {
+				m.Embedded = ident.Name
+				m.EmbeddedUid = hasField(embedded, "Uid")
+				break
+			}
+		}
+	}
+
+	if fn, ok := p.funcs[name+"Schema"]; ok && fn.Type.Params.NumFields() == 0 {
+		m.Schema = name + "Schema()"
+		m.Relations = schemaFuncRelations(fn)
+	} else {
+		m.Schema = fmt.Sprintf("graphor.SchemaOf(&%s{})", name)
+		m.Relations = p.tagRelations(st)
+	}
+
+	sort.Slice(m.Relations, func(i, j int) bool {
+		return m.Relations[i].Name < m.Relations[j].Name
+	})
+
+	return m
+}
+
+// schemaFuncRelations reads Relations entries from composite literals in XSchema().
+func schemaFuncRelations(fn *ast.FuncDecl) []relation {
+	relations := []relation{}
+
+	ast.Inspect(fn, func(n ast.Node) bool {
+		kv, ok := n.(*ast.KeyValueExpr)
+		if !ok || !isIdent(kv.Key, "Relations") {
+			return true
+		}
+		lit, ok := kv.Value.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+
+		for _, elt := range lit.Elts {
+			entry, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			key, ok := entry.Key.(*ast.BasicLit)
+			if !ok || key.Kind != token.STRING {
+				continue
+			}
+			name, _ := strconv.Unquote(key.Value)
+			r := relation{Name: name, Method: exported(name)}
+
+			if rs, ok := entry.Value.(*ast.CompositeLit); ok {
+				for _, e := range rs.Elts {
+					field, ok := e.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					switch {
+					case isIdent(field.Key, "HasMany"):
+						r.HasMany = isIdent(field.Value, "true")
+					case isIdent(field.Key, "SchemaFunc"):
+						if ident, ok := field.Value.(*ast.Ident); ok {
+							r.target = strings.TrimSuffix(ident.Name, "Schema")
+						}
+					}
+				}
+			}
+
+			relations = append(relations, r)
+		}
+
+		return false
+	})
+
+	return relations
+}
+
+// tagRelations reads fields tagged with `graphor:"relation,..."`, as graphor.SchemaOf does.
+func (p *pkg) tagRelations(st *ast.StructType) []relation {
+	relations := []relation{}
+
+	for _, field := range st.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		graphorTag, tagged := reflect.StructTag(tag).Lookup("graphor")
+
+		if len(field.Names) == 0 && !tagged {
+			if ident, ok := field.Type.(*ast.Ident); ok {
+				if embedded, ok := p.structs[ident.Name]; ok {
+					relations = append(relations, p.tagRelations(embedded)...)
+				}
+			}
+			continue
+		}
+
+		options := strings.Split(graphorTag, ",")
+		if options[0] != "relation" || len(field.Names) == 0 {
+			continue
+		}
+
+		name := strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Names[0].Name
+		}
+
+		r := relation{Name: name, Method: exported(name)}
+		typ := field.Type
+		for {
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			} else if array, ok := typ.(*ast.ArrayType); ok {
+				r.HasMany = true
+				typ = array.Elt
+			} else {
+				break
+			}
+		}
+		if ident, ok := typ.(*ast.Ident); ok {
+			r.target = ident.Name
+		}
+		for _, option := range options[1:] {
+			if strings.TrimSpace(option) == "many" {
+				r.HasMany = true
+			}
+		}
+
+		relations = append(relations, r)
+	}
+
+	return relations
+}
+
+func isModel(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if len(field.Names) > 0 {
+			continue
+		}
+		switch t := field.Type.(type) {
+		case *ast.SelectorExpr:
+			if t.Sel.Name == "ModelProperty" {
+				return true
+			}
+		case *ast.Ident:
+			if t.Name == "ModelProperty" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasField(st *ast.StructType, name string) bool {
+	for _, field := range st.Fields.List {
+		for _, ident := range field.Names {
+			if ident.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func receiverName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	s := string(r)
+	if token.Lookup(s).IsKeyword() {
+		return s + "_"
+	}
+	return s
+}
+
+// exported converts relation name (e.g. "follows", "liked_posts") into method name (Follows, LikedPosts).
+func exported(name string) string {
+	s := ""
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '~' }) {
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		s += string(r)
+	}
+	return s
+}
+
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// generate renders source of models, noting command in the header.
+func generate(pkgName string, models []*model, command string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, map[string]interface{}{
+		"Package": pkgName,
+		"Models":  models,
+		"Command": command,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %v\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+var tmpl = template.Must(template.New("graphor").Parse(`// Code generated by {{.Command}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/nosukeru/graphor"
+{{range .Models}}{{$m := .}}
+// ----- {{.Name}} -----
+
+{{if .Embedded -}}
+func New{{.Name}}(src ...*{{.Embedded}}) *{{.Name}} {
+	{{.Receiver}} := new({{.Name}})
+	if len(src) > 0 && src[0] != nil {
+		{{.Receiver}}.{{.Embedded}} = *src[0]
+		{{- if .EmbeddedUid}}
+		{{.Receiver}}.SetUid(src[0].Uid)
+		{{- end}}
+	}
+	return {{.Receiver}}
+}
+{{- else -}}
+func New{{.Name}}() *{{.Name}} {
+	return new({{.Name}})
+}
+{{- end}}
+
+// Query Utilities
+func {{.Plural}}() graphor.Query {
+	return graphor.BuildQuery({{.Schema}})
+}
+
+func As{{.Name}}(q graphor.Query) (*{{.Name}}, error) {
+	{{.Receiver}} := new({{.Name}})
+
+	data, err := q.First()
+	if data == nil {
+		return nil, err
+	}
+
+	graphor.Init({{.Receiver}}, data)
+	return {{.Receiver}}, nil
+}
+
+func As{{.Plural}}(q graphor.Query) ([]*{{.Name}}, error) {
+	list := []*{{.Name}}{}
+
+	dataList, err := q.All()
+	if dataList == nil {
+		return nil, err
+	}
+
+	for _, data := range dataList {
+		{{.Receiver}} := new({{.Name}})
+		graphor.Init({{.Receiver}}, data)
+		list = append(list, {{.Receiver}})
+	}
+
+	return list, nil
+}
+
+// Mutation Utilities
+func ({{.Receiver}} *{{.Name}}) Save(m *graphor.Mutation) error {
+	return m.Save({{.Receiver}}, {{.Schema}})
+}
+
+func ({{.Receiver}} *{{.Name}}) Delete(m *graphor.Mutation) {
+	m.Delete({{.Receiver}})
+}
+{{- if .Relations}}
+
+// Relation Utilities
+{{- end}}
+{{- range $i, $r := .Relations}}
+{{if $i}}
+{{end -}}
+{{if .Target -}}
+func ({{$m.Receiver}} *{{$m.Name}}) Has{{.Method}}() graphor.TypedRelation[*{{.Target.Name}}] {
+	return graphor.TypedRelation[*{{.Target.Name}}]{Relation: graphor.BuildRelation({{$m.Receiver}}, {{$m.Schema}}.Relations["{{.Name}}"])}
+}
+
+func ({{$m.Receiver}} *{{$m.Name}}) Load{{.Method}}(scopes ...func(q graphor.Query) graphor.Query) ({{if .HasMany}}[]{{end}}*{{.Target.Name}}, error) {
+	var q graphor.Query = {{$m.Receiver}}.Has{{.Method}}()
+	for _, scope := range scopes {
+		q = scope(q)
+	}
+	return As{{if .HasMany}}{{.Target.Plural}}{{else}}{{.Target.Name}}{{end}}(q)
+}
+{{- else -}}
+func ({{$m.Receiver}} *{{$m.Name}}) Has{{.Method}}() graphor.Relation {
+	return graphor.BuildRelation({{$m.Receiver}}, {{$m.Schema}}.Relations["{{.Name}}"])
+}
+{{- end}}
+{{- end}}
+{{end}}`))
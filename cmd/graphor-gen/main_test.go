@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		types  string
+		golden string
+	}{
+		{"all models", "", "all.golden"},
+		{"selected models", "User,Image", "selected.golden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePackage("testdata/models")
+			if err != nil {
+				t.Fatal(err)
+			}
+			models, err := p.models(tt.types)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, err := generate(p.Name, models, "graphor-gen")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(src, want) {
+				t.Errorf("generate() differs from %s (run go test -update to accept):\n%s", golden, src)
+			}
+		})
+	}
+}
+
+func TestModelsErrors(t *testing.T) {
+	p, err := parsePackage("testdata/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, types := range []string{"Missing", "NotModel", "User,NotModel"} {
+		if _, err := p.models(types); err == nil {
+			t.Errorf("models(%q) succeeded, want error", types)
+		}
+	}
+
+	if _, err := parsePackage("testdata/empty"); err == nil {
+		t.Errorf("parsePackage() of directory without go files succeeded, want error")
+	}
+}
+
+func TestNames(t *testing.T) {
+	models := []struct {
+		name, plural, receiver string
+	}{
+		{"User", "Users", "user"},
+		{"Box", "Boxes", "box"},
+		{"Category", "Categories", "category"},
+		{"Day", "Days", "day"},
+		{"Func", "Funcs", "func_"},
+	}
+	for _, tt := range models {
+		if got := plural(tt.name); got != tt.plural {
+			t.Errorf("plural(%q) = %q, want %q", tt.name, got, tt.plural)
+		}
+		if got := receiverName(tt.name); got != tt.receiver {
+			t.Errorf("receiverName(%q) = %q, want %q", tt.name, got, tt.receiver)
+		}
+	}
+
+	relations := []struct {
+		name, method string
+	}{
+		{"follows", "Follows"},
+		{"liked_posts", "LikedPosts"},
+		{"~follow", "Follow"},
+	}
+	for _, tt := range relations {
+		if got := exported(tt.name); got != tt.method {
+			t.Errorf("exported(%q) = %q, want %q", tt.name, got, tt.method)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import "github.com/nosukeru/graphor"
+
+// Models with schema from struct tags
+
+type UserModel struct {
+	Uid  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+type User struct {
+	graphor.ModelProperty `graphor:"tag=1"`
+	UserModel
+	Icon      *Image   `json:"icon" graphor:"relation,edge=has_icon,include"`
+	Follows   []*User  `json:"follows" graphor:"relation,edge=follow"`
+	Followers []*User  `json:"followers" graphor:"relation,edge=~follow"`
+	Company   *Company `json:"company" graphor:"relation,edge=works_at"`
+	Hidden    *User    `json:"-" graphor:"relation,edge=hidden"`
+}
+
+type Image struct {
+	graphor.ModelProperty `graphor:"tag=2"`
+	Url                   string `json:"url" graphor:"field"`
+}
+
+// Company isn't generated with -type User,Image, so relations to it have no LoadY.
+type Company struct {
+	graphor.ModelProperty `graphor:"tag=3"`
+}
+
+// Models with hand-written schema
+
+type Category struct {
+	graphor.ModelProperty
+}
+
+func CategorySchema() graphor.Schema {
+	return graphor.Schema{
+		Tag:    4,
+		Fields: []string{"name"},
+		Relations: map[string]graphor.RelationSchema{
+			"parent": {
+				Edge:       "parent",
+				SchemaFunc: CategorySchema,
+			},
+			"liked_by": {
+				Edge:       "~like",
+				HasMany:    true,
+				SchemaFunc: graphor.EmptySchema,
+			},
+		},
+	}
+}
+
+// Box checks plural and receiver names.
+type Box struct {
+	graphor.ModelProperty
+}
+
+type Func struct {
+	graphor.ModelProperty
+}
+
+// NotModel doesn't embed ModelProperty.
+type NotModel struct {
+	Name string
+}
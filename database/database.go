@@ -3,8 +3,8 @@ package database
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/dgraph-io/dgo"
 	"github.com/dgraph-io/dgo/protos/api"
@@ -15,33 +15,119 @@ import (
 type Database interface {
 	Clear() error
 	Migrate(body string) error
-	Insert(q string)
-	Delete(q string)
-	InitMutation()
-	RunMutation() (map[string]string, error)
-	Query(q string) ([]interface{}, error)
+	RunMutation(ctx context.Context, m *Mutation) (map[string]string, error)
+	Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error)
+	QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) // raw response, e.g. {"q": [...]}
+	NewTxn() Txn
+	Schema(ctx context.Context) ([]Predicate, error)
+	Close() error
 }
 
-type mutation struct {
+// Predicate is a predicate definition in current dgraph schema.
+type Predicate struct {
+	Predicate string   `json:"predicate"`
+	Type      string   `json:"type"`
+	Index     bool     `json:"index"`
+	Tokenizer []string `json:"tokenizer"`
+	Reverse   bool     `json:"reverse"`
+	Count     bool     `json:"count"`
+	List      bool     `json:"list"`
+	Upsert    bool     `json:"upsert"`
+	Lang      bool     `json:"lang"`
+}
+
+// Mutation buffers JSON set/delete mutations to be run in a single transaction.
+type Mutation struct {
 	Insertions []string
 	Deletions  []string
 }
 
+func NewMutation() *Mutation {
+	return &Mutation{[]string{}, []string{}}
+}
+
+func (m *Mutation) Insert(q string) {
+	m.Insertions = append(m.Insertions, q)
+}
+
+func (m *Mutation) Delete(q string) {
+	m.Deletions = append(m.Deletions, q)
+}
+
+func (m *Mutation) IsEmpty() bool {
+	return len(m.Insertions) == 0 && len(m.Deletions) == 0
+}
+
 type database struct {
-	Client   *dgo.Dgraph
-	Mutation *mutation
+	Client *dgo.Dgraph
+	conns  []*grpc.ClientConn
 }
 
-func NewDatabase() (Database, error) {
-	d, err := grpc.Dial("localhost:9080", grpc.WithInsecure())
+// NewDatabase connects to dgraph with given options, or OptionsFromEnv if omitted.
+// At most one Options can be given.
+func NewDatabase(options ...Options) (Database, error) {
+	var opts Options
+	if len(options) > 1 {
+		return nil, errors.New(errors.InvalidOptions, "Only one Options can be given.").Add("count", strconv.Itoa(len(options)))
+	} else if len(options) == 1 {
+		opts = options[0]
+	} else {
+		var err error
+		opts, err = OptionsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New(errors.InvalidOptions, "No dgraph address given.")
+	}
+
+	dialOpts, err := opts.dialOptions()
 	if err != nil {
-		return nil, errors.New(errors.ConnectionRefused, err.Error())
+		return nil, err
 	}
 
-	c := dgo.NewDgraphClient(api.NewDgraphClient(d))
-	m := new(mutation)
+	conns := []*grpc.ClientConn{}
+	clients := []api.DgraphClient{}
+	for _, addr := range opts.Addrs {
+		d, err := dial(addr, opts.DialTimeout, dialOpts)
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, errors.New(errors.ConnectionRefused, err.Error()).Add("addr", addr)
+		}
+
+		conns = append(conns, d)
+		clients = append(clients, api.NewDgraphClient(d))
+	}
+
+	c := dgo.NewDgraphClient(clients...)
+
+	return &database{c, conns}, nil
+}
+
+func dial(addr string, timeout time.Duration, dialOpts []grpc.DialOption) (*grpc.ClientConn, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return grpc.DialContext(ctx, addr, dialOpts...)
+}
 
-	return &database{c, m}, nil
+// Close closes connections to all Alpha nodes.
+func (db *database) Close() error {
+	var closeErr error
+	for _, conn := range db.conns {
+		if err := conn.Close(); err != nil && closeErr == nil {
+			closeErr = errors.New(errors.ConnectionRefused, err.Error()).Add("addr", conn.Target())
+		}
+	}
+	return closeErr
 }
 
 func (db *database) Clear() error {
@@ -70,91 +156,58 @@ func (db *database) Migrate(body string) error {
 	return nil
 }
 
-func (db *database) Insert(q string) {
-	db.Mutation.Insertions = append(db.Mutation.Insertions, q)
-}
-
-func (db *database) Delete(q string) {
-	db.Mutation.Deletions = append(db.Mutation.Deletions, q)
-}
-
-func (db *database) InitMutation() {
-	db.Mutation = new(mutation)
-}
-
-func (db *database) RunMutation() (map[string]string, error) {
-	ctx := context.Background()
-
-	txn := db.Client.NewTxn()
+func (db *database) RunMutation(ctx context.Context, m *Mutation) (map[string]string, error) {
+	txn := db.NewTxn()
 	defer txn.Discard(ctx)
 
-	// delete
-	if len(db.Mutation.Deletions) > 0 {
-		mu := new(api.Mutation)
-		deletion := fmt.Sprintf("[%s]", strings.Join(db.Mutation.Deletions, ","))
-
-		mu.DeleteJson = []byte(deletion)
-		_, err := txn.Mutate(ctx, mu)
-
-		if err != nil {
-			return nil, errors.New(errors.InsertionFailed, err.Error()).Add("deletion", deletion)
-		}
+	uids, err := txn.Mutate(ctx, m)
+	if err != nil {
+		return nil, err
 	}
 
-	// set
-	uids := map[string]string{}
+	err = txn.Commit(ctx)
+	if err != nil {
+		return uids, err
+	}
+	return uids, nil
+}
 
-	if len(db.Mutation.Insertions) > 0 {
-		mu := new(api.Mutation)
-		insertion := fmt.Sprintf("[%s]", strings.Join(db.Mutation.Insertions, ","))
+func (db *database) Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
 
-		mu.SetJson = []byte(insertion)
-		res, err := txn.Mutate(ctx, mu)
+	return txn.Query(ctx, q, vars)
+}
 
-		if err != nil {
-			return nil, errors.New(errors.DeletionFailed, err.Error()).Add("insertion", insertion)
-		}
+func (db *database) QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
 
-		uids = res.Uids
-	}
+	return txn.QueryJSON(ctx, q, vars)
+}
 
-	err := txn.Commit(ctx)
-	if err != nil {
-		return uids, errors.New(errors.MutationCommitFailed, err.Error())
-	}
-	return uids, nil
+func (db *database) NewTxn() Txn {
+	return &txn{db.Client.NewTxn()}
 }
 
-func (db *database) Query(q string) ([]interface{}, error) {
-	ctx := context.Background()
-	txn := db.Client.NewTxn()
+func (db *database) Schema(ctx context.Context) ([]Predicate, error) {
+	txn := db.Client.NewReadOnlyTxn()
 	defer txn.Discard(ctx)
 
+	q := "schema {}"
 	res, err := txn.Query(ctx, q)
 	if err != nil {
 		return nil, errors.New(errors.QueryFailed, err.Error()).Add("q", q)
 	}
 
-	var r interface{}
+	var r struct {
+		Schema []Predicate `json:"schema"`
+	}
 	err = json.Unmarshal(res.Json, &r)
 
 	if err != nil {
 		return nil, errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(res.Json))
 	}
 
-	data := r.(map[string]interface{})["q"]
-	if data == nil {
-		return []interface{}{}, nil
-	}
-
-	results := data.([]interface{})
-
-	// groupby
-	if len(results) > 0 {
-		if ar, ok := results[0].(map[string]interface{})["@groupby"]; ok {
-			return ar.([]interface{}), nil
-		}
-	}
-
-	return results, nil
+	return r.Schema, nil
 }
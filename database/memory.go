@@ -0,0 +1,622 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+// memNode is a node of memoryDatabase, holding scalar values and outgoing edges.
+type memNode struct {
+	Values map[string]interface{}
+	Edges  map[string][]memEdge
+}
+
+type memEdge struct {
+	To     uint64
+	Facets map[string]interface{}
+}
+
+type memStore struct {
+	Nodes map[uint64]*memNode
+}
+
+func newMemStore() *memStore {
+	return &memStore{map[uint64]*memNode{}}
+}
+
+func (s *memStore) clone() *memStore {
+	c := newMemStore()
+	for uid, n := range s.Nodes {
+		node := &memNode{map[string]interface{}{}, map[string][]memEdge{}}
+		for pred, v := range n.Values {
+			node.Values[pred] = v
+		}
+		for pred, edges := range n.Edges {
+			node.Edges[pred] = append([]memEdge{}, edges...)
+		}
+		c.Nodes[uid] = node
+	}
+	return c
+}
+
+func (s *memStore) node(uid uint64) *memNode {
+	n, ok := s.Nodes[uid]
+	if !ok {
+		n = &memNode{map[string]interface{}{}, map[string][]memEdge{}}
+		s.Nodes[uid] = n
+	}
+	return n
+}
+
+// memoryDatabase is a Database keeping data in memory, for tests.
+type memoryDatabase struct {
+	mutex     sync.RWMutex
+	store     *memStore
+	schema    map[string]Predicate
+	version   int            // incremented by each commit
+	written   map[string]int // conflict key -> version of the last commit writing it
+	clearedAt int
+	lastUid   uint64
+}
+
+// NewMemoryDatabase returns a Database which keeps data in memory, so that models & relations can be tested without dgraph.
+// It interprets the subset of GraphQL+- generated by graphor: eq(tag), uid(), has, regexp, term & text search, comparisons,
+// orderasc/orderdesc, first/offset/after, @filter, @facets and count. As in dgraph, a transaction is aborted
+// (errors.TxnAborted) only if another one committed in between writes the same predicate of the same node,
+// the same edge, or the same value of an @upsert predicate.
+func NewMemoryDatabase() Database {
+	return &memoryDatabase{
+		store:   newMemStore(),
+		schema:  map[string]Predicate{},
+		written: map[string]int{},
+	}
+}
+
+func (db *memoryDatabase) Clear() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.store = newMemStore()
+	db.schema = map[string]Predicate{}
+	db.version++
+	db.written = map[string]int{}
+	db.clearedAt = db.version
+	return nil
+}
+
+// Close does nothing; the data is kept until the database is garbage collected.
+func (db *memoryDatabase) Close() error {
+	return nil
+}
+
+var schemaLinePattern = regexp.MustCompile(`^([^\s:]+)\s*:\s*(\[?\w+\]?)\s*(.*?)\s*\.$`)
+var directivePattern = regexp.MustCompile(`@(\w+)(?:\(([^)]*)\))?`)
+
+func (db *memoryDatabase) Migrate(body string) error {
+	predicates := []Predicate{}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		m := schemaLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			return errors.New(errors.MigrationFailed, "Invalid schema line.").Add("line", line)
+		}
+
+		p := Predicate{Predicate: m[1], Type: strings.Trim(m[2], "[]"), List: strings.HasPrefix(m[2], "[")}
+		for _, d := range directivePattern.FindAllStringSubmatch(m[3], -1) {
+			switch d[1] {
+			case "index":
+				p.Index = true
+				for _, tokenizer := range strings.Split(d[2], ",") {
+					p.Tokenizer = append(p.Tokenizer, strings.TrimSpace(tokenizer))
+				}
+			case "reverse":
+				p.Reverse = true
+			case "count":
+				p.Count = true
+			case "lang":
+				p.Lang = true
+			case "upsert":
+				p.Upsert = true
+			}
+		}
+		predicates = append(predicates, p)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, p := range predicates {
+		db.schema[p.Predicate] = p
+	}
+	return nil
+}
+
+func (db *memoryDatabase) Schema(ctx context.Context) ([]Predicate, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	predicates := []Predicate{}
+	for _, p := range db.schema {
+		predicates = append(predicates, p)
+	}
+	sort.Slice(predicates, func(i, j int) bool { return predicates[i].Predicate < predicates[j].Predicate })
+
+	return predicates, nil
+}
+
+func (db *memoryDatabase) RunMutation(ctx context.Context, m *Mutation) (map[string]string, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	uids, err := txn.Mutate(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	err = txn.Commit(ctx)
+	if err != nil {
+		return uids, err
+	}
+	return uids, nil
+}
+
+func (db *memoryDatabase) Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	return txn.Query(ctx, q, vars)
+}
+
+func (db *memoryDatabase) QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) {
+	txn := db.NewTxn()
+	defer txn.Discard(ctx)
+
+	return txn.QueryJSON(ctx, q, vars)
+}
+
+func (db *memoryDatabase) NewTxn() Txn {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return &memoryTxn{db: db, version: db.version}
+}
+
+func (db *memoryDatabase) allocUid() uint64 {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.lastUid++
+	return db.lastUid
+}
+
+// memoryTxn works on its own copy of the store once it mutates. On commit, its mutations are replayed
+// onto the latest store of the database.
+type memoryTxn struct {
+	db        *memoryDatabase
+	version   int
+	store     *memStore
+	mutations []memMutation
+	upserts   map[string]bool // @upsert predicates
+	keys      map[string]bool // conflict keys written by this transaction
+	finished  bool
+}
+
+// memMutation is a decoded mutation, with blank nodes resolved to replay it on commit.
+type memMutation struct {
+	Deletions  []map[string]interface{}
+	Insertions []map[string]interface{}
+	Blanks     map[string]uint64
+}
+
+// snapshot returns the store to read. Committed stores are never modified in place.
+func (t *memoryTxn) snapshot() *memStore {
+	if t.store != nil {
+		return t.store
+	}
+
+	t.db.mutex.RLock()
+	defer t.db.mutex.RUnlock()
+	return t.db.store
+}
+
+func (t *memoryTxn) Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error) {
+	body, err := t.QueryJSON(ctx, q, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse(body)
+}
+
+func (t *memoryTxn) QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.New(errors.QueryFailed, err.Error()).Add("q", q)
+	}
+
+	results, err := runMemoryQuery(t.snapshot(), q, vars)
+	if err != nil {
+		return nil, errors.New(errors.QueryFailed, err.Error()).Add("q", q)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"q": results})
+	if err != nil {
+		return nil, errors.New(errors.UnmarshalizeFailed, err.Error())
+	}
+
+	return body, nil
+}
+
+func (t *memoryTxn) Mutate(ctx context.Context, m *Mutation) (map[string]string, error) {
+	if t.finished {
+		return nil, errors.New(errors.MutationCommitFailed, "Transaction has already been finished.")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.New(errors.InsertionFailed, err.Error())
+	}
+
+	if t.store == nil {
+		t.db.mutex.RLock()
+		t.store = t.db.store.clone()
+		t.upserts = map[string]bool{}
+		for name, p := range t.db.schema {
+			t.upserts[name] = p.Upsert
+		}
+		t.db.mutex.RUnlock()
+	}
+
+	mu := memMutation{Blanks: map[string]uint64{}}
+
+	// delete
+	for _, q := range m.Deletions {
+		objects, err := decodeMutation(q)
+		if err != nil {
+			return nil, errors.New(errors.DeletionFailed, err.Error()).Add("deletion", q)
+		}
+
+		for _, obj := range objects {
+			err := t.delete(obj)
+			if err != nil {
+				return nil, errors.New(errors.DeletionFailed, err.Error()).Add("deletion", q)
+			}
+		}
+		mu.Deletions = append(mu.Deletions, objects...)
+	}
+
+	// set
+	for _, q := range m.Insertions {
+		objects, err := decodeMutation(q)
+		if err != nil {
+			return nil, errors.New(errors.InsertionFailed, err.Error()).Add("insertion", q)
+		}
+
+		for _, obj := range objects {
+			_, err := t.set(obj, mu.Blanks)
+			if err != nil {
+				return nil, errors.New(errors.InsertionFailed, err.Error()).Add("insertion", q)
+			}
+		}
+		mu.Insertions = append(mu.Insertions, objects...)
+	}
+
+	t.mutations = append(t.mutations, mu)
+
+	uids := map[string]string{}
+	for name, uid := range mu.Blanks {
+		uids[name] = formatUid(uid)
+	}
+
+	return uids, nil
+}
+
+// replay applies mu again, with blank nodes and nodes without uid resolved by the first run.
+func (t *memoryTxn) replay(mu memMutation) error {
+	for _, obj := range mu.Deletions {
+		if err := t.delete(obj); err != nil {
+			return errors.New(errors.DeletionFailed, err.Error())
+		}
+	}
+
+	for _, obj := range mu.Insertions {
+		if _, err := t.set(obj, mu.Blanks); err != nil {
+			return errors.New(errors.InsertionFailed, err.Error())
+		}
+	}
+	return nil
+}
+
+// touch records conflict key of a write.
+func (t *memoryTxn) touch(key string) {
+	if t.keys == nil {
+		t.keys = map[string]bool{}
+	}
+	t.keys[key] = true
+}
+
+func (t *memoryTxn) touchValue(uid uint64, pred string, value interface{}) {
+	t.touch(fmt.Sprintf("%x|%s", uid, pred))
+	if t.upserts[pred] {
+		t.touch(fmt.Sprintf("%s=%v", pred, value))
+	}
+}
+
+func (t *memoryTxn) touchEdge(uid uint64, pred string, to uint64) {
+	t.touch(fmt.Sprintf("%x|%s|%x", uid, pred, to))
+}
+
+func (t *memoryTxn) Commit(ctx context.Context) error {
+	if t.finished {
+		return errors.New(errors.MutationCommitFailed, "Transaction has already been finished.")
+	}
+	t.finished = true
+
+	if t.store == nil {
+		return nil
+	}
+
+	t.db.mutex.Lock()
+	defer t.db.mutex.Unlock()
+
+	aborted := t.version < t.db.clearedAt
+	for key := range t.keys {
+		aborted = aborted || t.db.written[key] > t.version
+	}
+	if aborted {
+		return errors.New(errors.TxnAborted, "Transaction has been aborted. Please retry.")
+	}
+
+	latest := &memoryTxn{db: t.db, store: t.db.store.clone()}
+	for _, mu := range t.mutations {
+		if err := latest.replay(mu); err != nil {
+			return err
+		}
+	}
+
+	t.db.store = latest.store
+	t.db.version++
+	for key := range t.keys {
+		t.db.written[key] = t.db.version
+	}
+	return nil
+}
+
+func (t *memoryTxn) Discard(ctx context.Context) {
+	t.finished = true
+}
+
+func decodeMutation(q string) ([]map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewBufferString(q))
+	decoder.UseNumber()
+
+	var v interface{}
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{obj}, nil
+	case []interface{}:
+		objects := []map[string]interface{}{}
+		for _, o := range obj {
+			m, ok := o.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("mutation must be a JSON object: %v", o)
+			}
+			objects = append(objects, m)
+		}
+		return objects, nil
+	}
+
+	return nil, fmt.Errorf("mutation must be a JSON object: %v", v)
+}
+
+func (t *memoryTxn) resolveUid(v interface{}, blanks map[string]uint64) (uint64, error) {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		if v == nil {
+			return t.db.allocUid(), nil
+		}
+		return 0, fmt.Errorf("invalid uid: %v", v)
+	}
+
+	if strings.HasPrefix(s, "_:") {
+		name := s[2:]
+		if uid, ok := blanks[name]; ok {
+			return uid, nil
+		}
+		uid := t.db.allocUid()
+		blanks[name] = uid
+		return uid, nil
+	}
+
+	return parseUid(s)
+}
+
+// set applies a JSON set mutation object and returns its uid.
+func (t *memoryTxn) set(obj map[string]interface{}, blanks map[string]uint64) (uint64, error) {
+	uid, err := t.resolveUid(obj["uid"], blanks)
+	if err != nil {
+		return 0, err
+	}
+	obj["uid"] = formatUid(uid) // to replay with the same uid
+	node := t.store.node(uid)
+
+	for pred, value := range obj {
+		if pred == "uid" || strings.Contains(pred, "|") {
+			continue
+		}
+
+		switch v := value.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			if isGeoJSON(v) {
+				node.Values[pred] = v
+				t.touchValue(uid, pred, v)
+				continue
+			}
+			err := t.setEdge(uid, pred, v, blanks)
+			if err != nil {
+				return 0, err
+			}
+		case []interface{}:
+			if len(v) > 0 {
+				if child, ok := v[0].(map[string]interface{}); ok && !isGeoJSON(child) {
+					for _, c := range v {
+						child, ok := c.(map[string]interface{})
+						if !ok {
+							return 0, fmt.Errorf("mixed list for predicate %s", pred)
+						}
+						err := t.setEdge(uid, pred, child, blanks)
+						if err != nil {
+							return 0, err
+						}
+					}
+					continue
+				}
+			}
+			node.Values[pred] = v
+			t.touchValue(uid, pred, v)
+		default:
+			node.Values[pred] = v
+			t.touchValue(uid, pred, v)
+		}
+	}
+
+	return uid, nil
+}
+
+func (t *memoryTxn) setEdge(uid uint64, pred string, child map[string]interface{}, blanks map[string]uint64) error {
+	to, err := t.set(child, blanks)
+	if err != nil {
+		return err
+	}
+	node := t.store.node(uid)
+	t.touchEdge(uid, pred, to)
+
+	facets := map[string]interface{}{}
+	for key, v := range child {
+		if strings.HasPrefix(key, pred+"|") {
+			facets[key[len(pred)+1:]] = v
+		}
+	}
+
+	for i, e := range node.Edges[pred] {
+		if e.To == to {
+			node.Edges[pred][i].Facets = facets
+			return nil
+		}
+	}
+
+	node.Edges[pred] = append(node.Edges[pred], memEdge{to, facets})
+	return nil
+}
+
+// delete applies a JSON delete mutation object.
+func (t *memoryTxn) delete(obj map[string]interface{}) error {
+	s, ok := obj["uid"].(string)
+	if !ok {
+		return fmt.Errorf("uid is required for deletion")
+	}
+
+	uid, err := parseUid(s)
+	if err != nil {
+		return err
+	}
+
+	node, ok := t.store.Nodes[uid]
+	if !ok {
+		return nil
+	}
+
+	if len(obj) == 1 {
+		for pred, v := range node.Values {
+			t.touchValue(uid, pred, v)
+		}
+		for pred, edges := range node.Edges {
+			for _, e := range edges {
+				t.touchEdge(uid, pred, e.To)
+			}
+		}
+		node.Values = map[string]interface{}{}
+		node.Edges = map[string][]memEdge{}
+		return nil
+	}
+
+	for pred, value := range obj {
+		if pred == "uid" {
+			continue
+		}
+
+		targets := []interface{}{}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			targets = append(targets, v)
+		case []interface{}:
+			targets = v
+		default:
+			t.touchValue(uid, pred, node.Values[pred])
+			for _, e := range node.Edges[pred] {
+				t.touchEdge(uid, pred, e.To)
+			}
+			delete(node.Values, pred)
+			delete(node.Edges, pred)
+			continue
+		}
+
+		for _, target := range targets {
+			child, ok := target.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			to, err := parseUid(fmt.Sprint(child["uid"]))
+			if err != nil {
+				return err
+			}
+
+			t.touchEdge(uid, pred, to)
+			edges := []memEdge{}
+			for _, e := range node.Edges[pred] {
+				if e.To != to {
+					edges = append(edges, e)
+				}
+			}
+			node.Edges[pred] = edges
+		}
+	}
+
+	return nil
+}
+
+func isGeoJSON(obj map[string]interface{}) bool {
+	_, hasType := obj["type"]
+	_, hasCoordinates := obj["coordinates"]
+	return hasType && hasCoordinates
+}
+
+func parseUid(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid uid: %s", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
+
+func formatUid(uid uint64) string {
+	return fmt.Sprintf("0x%x", uid)
+}
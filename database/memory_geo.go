@@ -0,0 +1,258 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Geo functions of the in-memory database. Shapes are evaluated on a plane of longitude and latitude,
+// except that distances of near are great-circle distances.
+
+type geoPoint [2]float64 // longitude, latitude
+
+type geoPolygon [][]geoPoint // outer ring followed by holes
+
+const earthRadius = 6371008.8 // meters
+
+// matchGeo evaluates geo function fn of stored GeoJSON v against args.
+func matchGeo(fn string, v interface{}, args []mqValue) (bool, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || !isGeoJSON(obj) {
+		return false, nil
+	}
+
+	point, polygon, err := storedShape(obj)
+	if err != nil {
+		return false, err
+	}
+
+	switch fn {
+	case "near":
+		if len(args) < 2 {
+			return false, fmt.Errorf("near requires a point and distance")
+		}
+		center, err := pointArg(args[0])
+		if err != nil {
+			return false, err
+		}
+		distance, err := strconv.ParseFloat(args[1].Text, 64)
+		if err != nil {
+			return false, err
+		}
+
+		if polygon == nil {
+			return haversine(*point, center) <= distance, nil
+		}
+		for _, p := range polygon[0] {
+			if haversine(p, center) <= distance {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "within":
+		area, err := polygonArg(args[0])
+		if err != nil {
+			return false, err
+		}
+
+		if polygon == nil {
+			return area.contains(*point), nil
+		}
+		return area.containsAll(polygon[0]), nil
+	case "contains":
+		if polygon == nil {
+			return false, nil
+		}
+
+		if p, err := pointArg(args[0]); err == nil {
+			return polygon.contains(p), nil
+		}
+		area, err := polygonArg(args[0])
+		if err != nil {
+			return false, err
+		}
+		return polygon.containsAll(area[0]), nil
+	case "intersects":
+		area, err := polygonArg(args[0])
+		if err != nil {
+			return false, err
+		}
+
+		if polygon == nil {
+			return area.contains(*point), nil
+		}
+		return polygon.intersects(area), nil
+	}
+
+	return false, fmt.Errorf("function %s is not supported", fn)
+}
+
+// storedShape decodes GeoJSON of Point or Polygon.
+func storedShape(obj map[string]interface{}) (*geoPoint, geoPolygon, error) {
+	switch obj["type"] {
+	case "Point":
+		p, err := toPoint(obj["coordinates"])
+		return &p, nil, err
+	case "Polygon":
+		rings, ok := obj["coordinates"].([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid polygon: %v", obj["coordinates"])
+		}
+
+		polygon := geoPolygon{}
+		for _, r := range rings {
+			points, ok := r.([]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid polygon: %v", obj["coordinates"])
+			}
+
+			ring := []geoPoint{}
+			for _, c := range points {
+				p, err := toPoint(c)
+				if err != nil {
+					return nil, nil, err
+				}
+				ring = append(ring, p)
+			}
+			polygon = append(polygon, ring)
+		}
+		if len(polygon) == 0 {
+			return nil, nil, fmt.Errorf("empty polygon")
+		}
+		return nil, polygon, nil
+	}
+
+	return nil, nil, fmt.Errorf("geo type %v is not supported", obj["type"])
+}
+
+func toPoint(v interface{}) (geoPoint, error) {
+	c, ok := v.([]interface{})
+	if !ok || len(c) < 2 {
+		return geoPoint{}, fmt.Errorf("invalid point: %v", v)
+	}
+
+	lng, ok1 := toFloat(c[0])
+	lat, ok2 := toFloat(c[1])
+	if !ok1 || !ok2 {
+		return geoPoint{}, fmt.Errorf("invalid point: %v", v)
+	}
+	return geoPoint{lng, lat}, nil
+}
+
+// pointArg parses [lng, lat] in query.
+func pointArg(v mqValue) (geoPoint, error) {
+	if len(v.List) != 2 || v.List[0].List != nil || v.List[1].List != nil {
+		return geoPoint{}, fmt.Errorf("invalid point")
+	}
+
+	lng, err := strconv.ParseFloat(v.List[0].Text, 64)
+	if err != nil {
+		return geoPoint{}, err
+	}
+	lat, err := strconv.ParseFloat(v.List[1].Text, 64)
+	if err != nil {
+		return geoPoint{}, err
+	}
+	return geoPoint{lng, lat}, nil
+}
+
+// polygonArg parses [[[lng, lat], ...], ...] in query.
+func polygonArg(v mqValue) (geoPolygon, error) {
+	polygon := geoPolygon{}
+	for _, r := range v.List {
+		ring := []geoPoint{}
+		for _, c := range r.List {
+			p, err := pointArg(c)
+			if err != nil {
+				return nil, err
+			}
+			ring = append(ring, p)
+		}
+		polygon = append(polygon, ring)
+	}
+
+	if len(polygon) == 0 || len(polygon[0]) < 3 {
+		return nil, fmt.Errorf("invalid polygon")
+	}
+	return polygon, nil
+}
+
+// contains reports whether p is inside the outer ring and outside of holes.
+func (polygon geoPolygon) contains(p geoPoint) bool {
+	if !inRing(polygon[0], p) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if inRing(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (polygon geoPolygon) containsAll(points []geoPoint) bool {
+	for _, p := range points {
+		if !polygon.contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (polygon geoPolygon) intersects(other geoPolygon) bool {
+	for _, p := range other[0] {
+		if polygon.contains(p) {
+			return true
+		}
+	}
+	for _, p := range polygon[0] {
+		if other.contains(p) {
+			return true
+		}
+	}
+
+	a, b := polygon[0], other[0]
+	for i := 0; i+1 < len(a); i++ {
+		for j := 0; j+1 < len(b); j++ {
+			if segmentsCross(a[i], a[i+1], b[j], b[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inRing reports whether p is inside ring by ray casting.
+func inRing(ring []geoPoint, p geoPoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func segmentsCross(p1, p2, q1, q2 geoPoint) bool {
+	d1 := cross(q1, q2, p1)
+	d2 := cross(q1, q2, p2)
+	d3 := cross(p1, p2, q1)
+	d4 := cross(p1, p2, q2)
+	return ((d1 > 0) != (d2 > 0)) && ((d3 > 0) != (d4 > 0))
+}
+
+func cross(o, a, b geoPoint) float64 {
+	return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+}
+
+// haversine returns great-circle distance between a and b in meters.
+func haversine(a, b geoPoint) float64 {
+	lat1, lat2 := a[1]*math.Pi/180, b[1]*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b[0] - a[0]) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,1173 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ----- Lexer -----
+
+const (
+	tokPunct = iota
+	tokWord
+	tokString
+	tokIri
+	tokRegex
+	tokDirective
+	tokVar
+	tokEOF
+)
+
+type mqToken struct {
+	Kind int
+	Text string
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.~-+|*", r)
+}
+
+func lexQuery(q string) ([]mqToken, error) {
+	tokens := []mqToken{}
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("{}():,[]", r):
+			tokens = append(tokens, mqToken{tokPunct, string(r)})
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, mqToken{tokString, s})
+			i = j + 1
+		case r == '<':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '>'; j++ {
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated iri")
+			}
+			tokens = append(tokens, mqToken{tokIri, strings.TrimSpace(string(runes[i+1 : j]))})
+			i = j + 1
+		case r == '/':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '/'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated regex")
+			}
+			k := j + 1
+			for ; k < len(runes) && unicode.IsLetter(runes[k]); k++ {
+			}
+			tokens = append(tokens, mqToken{tokRegex, string(runes[i:k])})
+			i = k
+		case r == '@' || r == '$':
+			j := i + 1
+			for ; j < len(runes) && isWordRune(runes[j]); j++ {
+			}
+			kind := tokDirective
+			if r == '$' {
+				kind = tokVar
+			}
+			tokens = append(tokens, mqToken{kind, string(runes[i:j])})
+			i = j
+		case isWordRune(r):
+			j := i
+			for ; j < len(runes) && isWordRune(runes[j]); j++ {
+			}
+			tokens = append(tokens, mqToken{tokWord, string(runes[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+
+	return append(tokens, mqToken{tokEOF, ""}), nil
+}
+
+// ----- AST -----
+
+type mqOrder struct {
+	Key  string
+	Desc bool
+}
+
+type mqValue struct {
+	Kind int // tokWord, tokString, tokIri, tokRegex, or tokPunct for list
+	Text string
+	List []mqValue
+}
+
+type mqExpr struct {
+	Op       string // and, or, not, func
+	Children []*mqExpr
+	Func     string
+	Args     []mqValue
+}
+
+type mqFacetKey struct {
+	Alias string
+	Name  string
+}
+
+type mqFacets struct {
+	All    bool
+	Keys   []mqFacetKey
+	Order  []mqOrder
+	Filter *mqExpr
+}
+
+// mqSelection is a query block, or a predicate selected in a block.
+type mqSelection struct {
+	Alias    string
+	Pred     string
+	IsCount  bool
+	Func     *mqExpr
+	Order    []mqOrder
+	First    int
+	HasFirst bool
+	Offset   int
+	After    uint64
+	Filter   *mqExpr
+	Facets   *mqFacets
+	Children []*mqSelection
+	HasBody  bool
+}
+
+// ----- Parser -----
+
+type mqParser struct {
+	tokens []mqToken
+	pos    int
+	vars   map[string]string
+	types  map[string]string // declared types of vars
+}
+
+func (p *mqParser) peek() mqToken {
+	return p.tokens[p.pos]
+}
+
+func (p *mqParser) peekAt(offset int) mqToken {
+	if p.pos+offset >= len(p.tokens) {
+		return mqToken{tokEOF, ""}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *mqParser) next() mqToken {
+	t := p.tokens[p.pos]
+	if t.Kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *mqParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.Kind == tokPunct && t.Text == s
+}
+
+func (p *mqParser) expect(s string) error {
+	t := p.next()
+	if t.Kind != tokPunct || t.Text != s {
+		return fmt.Errorf("expected %q but got %q", s, t.Text)
+	}
+	return nil
+}
+
+func (p *mqParser) word() (string, error) {
+	t := p.next()
+	if t.Kind != tokWord {
+		return "", fmt.Errorf("expected name but got %q", t.Text)
+	}
+	return t.Text, nil
+}
+
+func parseMemoryQuery(q string, vars map[string]string) ([]*mqSelection, error) {
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &mqParser{tokens: tokens, vars: vars, types: map[string]string{}}
+
+	// query header with variable declarations, e.g. query q($a: string, $b: int)
+	if t := p.peek(); t.Kind == tokWord && t.Text == "query" {
+		for !p.isPunct("{") {
+			t := p.next()
+			switch {
+			case t.Kind == tokEOF:
+				return nil, fmt.Errorf("unexpected end of query")
+			case t.Kind == tokVar && p.isPunct(":"):
+				p.next()
+				typ, err := p.word()
+				if err != nil {
+					return nil, err
+				}
+				p.types[t.Text] = typ
+			}
+		}
+	}
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	blocks := []*mqSelection{}
+	for !p.isPunct("}") {
+		block, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+func (p *mqParser) block() (*mqSelection, error) {
+	name, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "var" || p.peek().Kind == tokWord && p.peek().Text == "as" {
+		return nil, fmt.Errorf("query variables are not supported")
+	}
+
+	s := &mqSelection{Alias: name}
+	if err := p.modifiers(s); err != nil {
+		return nil, err
+	}
+
+	if s.Func == nil {
+		return nil, fmt.Errorf("block %s has no root function", name)
+	}
+	if !s.HasBody {
+		return nil, fmt.Errorf("block %s has no body", name)
+	}
+	return s, nil
+}
+
+// modifiers parses arguments, directives and body following a block or predicate.
+func (p *mqParser) modifiers(s *mqSelection) error {
+	for {
+		t := p.peek()
+
+		switch {
+		case t.Kind == tokPunct && t.Text == "(":
+			if err := p.args(s); err != nil {
+				return err
+			}
+		case t.Kind == tokDirective && t.Text == "@filter":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			expr, err := p.expr()
+			if err != nil {
+				return err
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			if s.Filter != nil {
+				expr = &mqExpr{Op: "and", Children: []*mqExpr{s.Filter, expr}}
+			}
+			s.Filter = expr
+		case t.Kind == tokDirective && t.Text == "@facets":
+			p.next()
+			if err := p.facets(s); err != nil {
+				return err
+			}
+		case t.Kind == tokDirective:
+			return fmt.Errorf("directive %s is not supported", t.Text)
+		case t.Kind == tokPunct && t.Text == "{":
+			p.next()
+			s.HasBody = true
+			for !p.isPunct("}") {
+				child, err := p.selection()
+				if err != nil {
+					return err
+				}
+				s.Children = append(s.Children, child)
+			}
+			p.next()
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *mqParser) args(s *mqSelection) error {
+	p.next() // (
+	for !p.isPunct(")") {
+		key, err := p.word()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+
+		switch key {
+		case "func":
+			expr, err := p.function()
+			if err != nil {
+				return err
+			}
+			s.Func = expr
+		case "orderasc", "orderdesc":
+			pred, err := p.word()
+			if err != nil {
+				return err
+			}
+			s.Order = append(s.Order, mqOrder{pred, key == "orderdesc"})
+		case "first", "offset":
+			v, err := p.value()
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v.Text)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", key, v.Text)
+			}
+			if key == "first" {
+				s.First, s.HasFirst = n, true
+			} else {
+				s.Offset = n
+			}
+		case "after":
+			v, err := p.value()
+			if err != nil {
+				return err
+			}
+			uid, err := parseUid(v.Text)
+			if err != nil {
+				return err
+			}
+			s.After = uid
+		default:
+			return fmt.Errorf("argument %s is not supported", key)
+		}
+
+		if p.isPunct(",") {
+			p.next()
+		}
+	}
+	p.next() // )
+	return nil
+}
+
+func (p *mqParser) facets(s *mqSelection) error {
+	if s.Facets == nil {
+		s.Facets = &mqFacets{}
+	}
+
+	if !p.isPunct("(") {
+		s.Facets.All = true
+		return nil
+	}
+	p.next()
+
+	// filter, e.g. @facets(eq(close, true))
+	if t, after := p.peek(), p.peekAt(1); (t.Kind == tokWord && after.Kind == tokPunct && after.Text == "(") || t.Text == "not" || t.Text == "(" {
+		expr, err := p.expr()
+		if err != nil {
+			return err
+		}
+		s.Facets.Filter = expr
+		return p.expect(")")
+	}
+
+	for !p.isPunct(")") {
+		name, err := p.word()
+		if err != nil {
+			return err
+		}
+
+		if p.isPunct(":") {
+			p.next()
+			facet, err := p.word()
+			if err != nil {
+				return err
+			}
+
+			switch name {
+			case "orderasc", "orderdesc":
+				s.Facets.Order = append(s.Facets.Order, mqOrder{facet, name == "orderdesc"})
+			default:
+				s.Facets.Keys = append(s.Facets.Keys, mqFacetKey{name, facet})
+			}
+		} else {
+			s.Facets.Keys = append(s.Facets.Keys, mqFacetKey{"", name})
+		}
+
+		if p.isPunct(",") {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
+
+func (p *mqParser) selection() (*mqSelection, error) {
+	name, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mqSelection{}
+	if p.isPunct(":") {
+		p.next()
+		s.Alias = name
+		name, err = p.word()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "count" && p.isPunct("(") {
+		p.next()
+		pred, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		s.IsCount = true
+		name = pred
+	}
+
+	if p.peek().Kind == tokWord && p.peek().Text == "as" {
+		return nil, fmt.Errorf("query variables are not supported")
+	}
+
+	s.Pred = name
+	if err := p.modifiers(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// expr parses filter expression, where "and" binds tighter than "or".
+func (p *mqParser) expr() (*mqExpr, error) {
+	left, err := p.conjunction()
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.Kind == tokWord && t.Text == "or"; t = p.peek() {
+		p.next()
+		right, err := p.conjunction()
+		if err != nil {
+			return nil, err
+		}
+		left = &mqExpr{Op: "or", Children: []*mqExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *mqParser) conjunction() (*mqExpr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.Kind == tokWord && t.Text == "and"; t = p.peek() {
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = &mqExpr{Op: "and", Children: []*mqExpr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *mqParser) term() (*mqExpr, error) {
+	t := p.peek()
+
+	if t.Kind == tokWord && t.Text == "not" {
+		p.next()
+		child, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		return &mqExpr{Op: "not", Children: []*mqExpr{child}}, nil
+	}
+
+	if t.Kind == tokPunct && t.Text == "(" {
+		p.next()
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+
+	return p.function()
+}
+
+func (p *mqParser) function() (*mqExpr, error) {
+	name, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	expr := &mqExpr{Op: "func", Func: name}
+	for !p.isPunct(")") {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		expr.Args = append(expr.Args, v)
+
+		if p.isPunct(",") {
+			p.next()
+		}
+	}
+	p.next()
+	return expr, nil
+}
+
+func (p *mqParser) value() (mqValue, error) {
+	t := p.next()
+
+	switch t.Kind {
+	case tokWord, tokString, tokIri, tokRegex:
+		return mqValue{Kind: t.Kind, Text: t.Text}, nil
+	case tokVar:
+		v, ok := p.vars[t.Text]
+		if !ok {
+			return mqValue{}, fmt.Errorf("variable %s is not defined", t.Text)
+		}
+		switch p.types[t.Text] {
+		case "int", "float", "bool":
+			return mqValue{Kind: tokWord, Text: v}, nil
+		}
+		return mqValue{Kind: tokString, Text: v}, nil
+	case tokPunct:
+		if t.Text == "[" {
+			list := mqValue{Kind: tokPunct, List: []mqValue{}}
+			for !p.isPunct("]") {
+				v, err := p.value()
+				if err != nil {
+					return mqValue{}, err
+				}
+				list.List = append(list.List, v)
+
+				if p.isPunct(",") {
+					p.next()
+				}
+			}
+			p.next()
+			return list, nil
+		}
+	}
+
+	return mqValue{}, fmt.Errorf("unexpected %q", t.Text)
+}
+
+// ----- Evaluator -----
+
+type mqEvaluator struct {
+	store *memStore
+}
+
+func runMemoryQuery(store *memStore, q string, vars map[string]string) ([]interface{}, error) {
+	blocks, err := parseMemoryQuery(q, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &mqEvaluator{store}
+	for _, block := range blocks {
+		if block.Alias != "q" {
+			continue
+		}
+		return e.root(block)
+	}
+
+	return []interface{}{}, nil
+}
+
+func (e *mqEvaluator) root(block *mqSelection) ([]interface{}, error) {
+	uids := []uint64{}
+
+	if block.Func.Func == "uid" {
+		for _, arg := range block.Func.Args {
+			for _, v := range flattenValues(arg) {
+				uid, err := parseUid(v.Text)
+				if err != nil {
+					return nil, err
+				}
+				uids = append(uids, uid)
+			}
+		}
+	} else {
+		for uid := range e.store.Nodes {
+			ok, err := e.match(block.Func, uid, nil)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				uids = append(uids, uid)
+			}
+		}
+	}
+
+	targets := []memEdge{}
+	for _, uid := range uids {
+		targets = append(targets, memEdge{uid, nil})
+	}
+
+	targets, err := e.narrow(block, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.render(block, "", targets)
+}
+
+// narrow filters, sorts and paginates targets according to s.
+func (e *mqEvaluator) narrow(s *mqSelection, targets []memEdge) ([]memEdge, error) {
+	filtered := []memEdge{}
+	for _, t := range targets {
+		if t.To <= s.After {
+			continue
+		}
+
+		if s.Facets != nil && s.Facets.Filter != nil {
+			ok, err := e.match(s.Facets.Filter, t.To, t.Facets)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if s.Filter != nil {
+			ok, err := e.match(s.Filter, t.To, nil)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		filtered = append(filtered, t)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].To < filtered[j].To })
+
+	orders := []mqOrder{}
+	facetOrder := false
+	if s.Facets != nil && len(s.Facets.Order) > 0 {
+		orders, facetOrder = s.Facets.Order, true
+	} else {
+		orders = s.Order
+	}
+
+	if len(orders) > 0 {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			for _, o := range orders {
+				var a, b interface{}
+				if facetOrder {
+					a, b = filtered[i].Facets[o.Key], filtered[j].Facets[o.Key]
+				} else {
+					a, b = e.scalar(filtered[i].To, o.Key), e.scalar(filtered[j].To, o.Key)
+				}
+
+				// nodes without the key come last
+				if a == nil || b == nil {
+					if a == nil && b == nil {
+						continue
+					}
+					return b == nil
+				}
+
+				c := compareValues(a, b)
+				if c == 0 {
+					continue
+				}
+				if o.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if s.Offset > 0 {
+		if s.Offset >= len(filtered) {
+			filtered = []memEdge{}
+		} else {
+			filtered = filtered[s.Offset:]
+		}
+	}
+
+	if s.HasFirst {
+		if s.First >= 0 && s.First < len(filtered) {
+			filtered = filtered[:s.First]
+		} else if s.First < 0 && -s.First < len(filtered) {
+			filtered = filtered[len(filtered)+s.First:]
+		}
+	}
+
+	return filtered, nil
+}
+
+// render builds result objects of targets reached by edge pred, omitting empty ones.
+func (e *mqEvaluator) render(s *mqSelection, pred string, targets []memEdge) ([]interface{}, error) {
+	results := []interface{}{}
+
+	for _, c := range s.Children {
+		if c.IsCount && c.Pred == "uid" {
+			key := "count"
+			if c.Alias != "" {
+				key = c.Alias
+			}
+			results = append(results, map[string]interface{}{key: len(targets)})
+		}
+	}
+
+	for _, t := range targets {
+		obj, err := e.object(s, t.To)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Facets != nil && pred != "" {
+			if s.Facets.All {
+				for name, v := range t.Facets {
+					obj[pred+"|"+name] = v
+				}
+			}
+			for _, key := range s.Facets.Keys {
+				v, ok := t.Facets[key.Name]
+				if !ok {
+					continue
+				}
+				if key.Alias != "" {
+					obj[key.Alias] = v
+				} else {
+					obj[pred+"|"+key.Name] = v
+				}
+			}
+		}
+
+		if len(obj) > 0 {
+			results = append(results, obj)
+		}
+	}
+
+	return results, nil
+}
+
+func (e *mqEvaluator) object(s *mqSelection, uid uint64) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	node := e.store.Nodes[uid]
+
+	for _, c := range s.Children {
+		key := c.Pred
+		if c.Alias != "" {
+			key = c.Alias
+		}
+
+		switch {
+		case c.IsCount && c.Pred == "uid":
+			continue
+		case c.IsCount:
+			targets, err := e.narrow(c, e.edges(uid, c.Pred))
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = len(targets)
+		case c.Pred == "uid":
+			obj[key] = formatUid(uid)
+		case c.HasBody:
+			targets, err := e.narrow(c, e.edges(uid, c.Pred))
+			if err != nil {
+				return nil, err
+			}
+			children, err := e.render(c, c.Pred, targets)
+			if err != nil {
+				return nil, err
+			}
+			if len(children) > 0 {
+				obj[key] = children
+			}
+		default:
+			if node == nil {
+				continue
+			}
+			if v, ok := node.Values[c.Pred]; ok {
+				obj[key] = v
+			}
+		}
+	}
+
+	return obj, nil
+}
+
+// edges returns outgoing edges of pred, or incoming ones for ~pred.
+func (e *mqEvaluator) edges(uid uint64, pred string) []memEdge {
+	if strings.HasPrefix(pred, "~") {
+		pred = pred[1:]
+		edges := []memEdge{}
+		for from, node := range e.store.Nodes {
+			for _, edge := range node.Edges[pred] {
+				if edge.To == uid {
+					edges = append(edges, memEdge{from, edge.Facets})
+				}
+			}
+		}
+		return edges
+	}
+
+	node, ok := e.store.Nodes[uid]
+	if !ok {
+		return []memEdge{}
+	}
+	return node.Edges[pred]
+}
+
+func (e *mqEvaluator) scalar(uid uint64, pred string) interface{} {
+	node, ok := e.store.Nodes[uid]
+	if !ok {
+		return nil
+	}
+	return node.Values[pred]
+}
+
+// values returns values of pred of a node, or of facets if given.
+func (e *mqEvaluator) values(uid uint64, facets map[string]interface{}, pred string) []interface{} {
+	var v interface{}
+	if facets != nil {
+		v = facets[pred]
+	} else {
+		v = e.scalar(uid, pred)
+	}
+
+	switch list := v.(type) {
+	case nil:
+		return []interface{}{}
+	case []interface{}:
+		return list
+	}
+	return []interface{}{v}
+}
+
+func (e *mqEvaluator) match(expr *mqExpr, uid uint64, facets map[string]interface{}) (bool, error) {
+	switch expr.Op {
+	case "and", "or":
+		for _, c := range expr.Children {
+			ok, err := e.match(c, uid, facets)
+			if err != nil {
+				return false, err
+			}
+			if expr.Op == "and" && !ok {
+				return false, nil
+			}
+			if expr.Op == "or" && ok {
+				return true, nil
+			}
+		}
+		return expr.Op == "and", nil
+	case "not":
+		ok, err := e.match(expr.Children[0], uid, facets)
+		return !ok, err
+	}
+
+	args := expr.Args
+	if expr.Func == "uid" {
+		for _, arg := range args {
+			for _, v := range flattenValues(arg) {
+				target, err := parseUid(v.Text)
+				if err != nil {
+					return false, err
+				}
+				if target == uid {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	if len(args) == 0 {
+		return false, fmt.Errorf("%s requires arguments", expr.Func)
+	}
+	pred := args[0].Text
+	args = args[1:]
+
+	if expr.Func == "has" {
+		if facets != nil {
+			_, ok := facets[pred]
+			return ok, nil
+		}
+		return len(e.values(uid, nil, pred)) > 0 || len(e.edges(uid, pred)) > 0, nil
+	}
+
+	if expr.Func == "uid_in" {
+		for _, arg := range args {
+			for _, v := range flattenValues(arg) {
+				target, err := parseUid(v.Text)
+				if err != nil {
+					return false, err
+				}
+				for _, edge := range e.edges(uid, pred) {
+					if edge.To == target {
+						return true, nil
+					}
+				}
+			}
+		}
+		return false, nil
+	}
+
+	if len(args) == 0 {
+		return false, fmt.Errorf("%s requires a value", expr.Func)
+	}
+
+	values := e.values(uid, facets, pred)
+	for _, v := range values {
+		ok, err := matchValue(expr.Func, v, args)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func matchValue(fn string, v interface{}, args []mqValue) (bool, error) {
+	switch fn {
+	case "eq", "lt", "le", "gt", "ge":
+		for _, arg := range flattenValues(args[0]) {
+			c := compareValues(v, literal(arg))
+			switch {
+			case fn == "eq" && c == 0, fn == "lt" && c < 0, fn == "le" && c <= 0, fn == "gt" && c > 0, fn == "ge" && c >= 0:
+				return true, nil
+			}
+		}
+		return false, nil
+	case "regexp":
+		pattern := args[0].Text
+		end := strings.LastIndex(pattern, "/")
+		if !strings.HasPrefix(pattern, "/") || end <= 0 {
+			return false, fmt.Errorf("invalid regexp %s", pattern)
+		}
+		expr := pattern[1:end]
+		if strings.Contains(pattern[end+1:], "i") {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(v)), nil
+	case "anyofterms", "anyoftext", "allofterms", "alloftext":
+		terms := tokenizeTerms(fmt.Sprint(v))
+		queries := tokenizeTerms(args[0].Text)
+		if len(queries) == 0 {
+			return false, nil
+		}
+		all := strings.HasPrefix(fn, "all")
+		for term := range queries {
+			if terms[term] && !all {
+				return true, nil
+			}
+			if !terms[term] && all {
+				return false, nil
+			}
+		}
+		return all, nil
+	case "near", "within", "contains", "intersects":
+		return matchGeo(fn, v, args)
+	case "match":
+		distance := 8
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1].Text)
+			if err != nil {
+				return false, err
+			}
+			distance = n
+		}
+		return levenshtein(strings.ToLower(fmt.Sprint(v)), strings.ToLower(args[0].Text)) <= distance, nil
+	}
+
+	return false, fmt.Errorf("function %s is not supported", fn)
+}
+
+func flattenValues(v mqValue) []mqValue {
+	// uid list given by variable, e.g. uid($uids) with "[0x1, 0x2]"
+	if v.Kind == tokString && strings.HasPrefix(v.Text, "[") && strings.HasSuffix(v.Text, "]") {
+		values := []mqValue{}
+		for _, item := range strings.Split(v.Text[1:len(v.Text)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, mqValue{Kind: tokWord, Text: item})
+			}
+		}
+		return values
+	}
+
+	if v.List == nil {
+		return []mqValue{v}
+	}
+
+	values := []mqValue{}
+	for _, c := range v.List {
+		values = append(values, flattenValues(c)...)
+	}
+	return values
+}
+
+// literal converts a value in query into stored value representation.
+func literal(v mqValue) interface{} {
+	if v.Kind == tokWord {
+		switch v.Text {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+		return json.Number(v.Text)
+	}
+	return v.Text
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case int:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// compareValues compares numerically if both are numbers, and as strings otherwise.
+func compareValues(a interface{}, b interface{}) int {
+	_, aString := a.(string)
+	_, bString := b.(string)
+
+	if !aString || !bString {
+		if x, ok := toInt(a); ok {
+			if y, ok := toInt(b); ok {
+				switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+				}
+				return 0
+			}
+		}
+
+		if x, ok := toFloat(a); ok {
+			if y, ok := toFloat(b); ok {
+				switch {
+				case x < y:
+					return -1
+				case x > y:
+					return 1
+				}
+				return 0
+			}
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func tokenizeTerms(s string) map[string]bool {
+	terms := map[string]bool{}
+	for _, term := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms[term] = true
+	}
+	return terms
+}
+
+func levenshtein(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		cur := make([]int, len(t)+1)
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(t)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mutation(insertions ...string) *Mutation {
+	m := NewMutation()
+	m.Insertions = insertions
+	return m
+}
+
+// seed saves insertions and returns uids of blank nodes.
+func seed(t *testing.T, db Database, insertions ...string) map[string]string {
+	t.Helper()
+
+	uids, err := db.RunMutation(context.Background(), mutation(insertions...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uids
+}
+
+// seedUsers saves alice (age 20) -> follows bob (since 5) and carol (since 10), bob (age 30), carol (age 40),
+// and returns their uids keyed by name.
+func seedUsers(t *testing.T, db Database) map[string]string {
+	t.Helper()
+
+	return seed(t, db, `[
+		{"uid": "_:alice", "name": "alice", "age": 20, "bio": "go dgraph",
+			"follow": [{"uid": "_:bob", "follow|since": 5}, {"uid": "_:carol", "follow|since": 10}]},
+		{"uid": "_:bob", "name": "bob", "age": 30, "bio": "rust"},
+		{"uid": "_:carol", "name": "carol", "age": 40, "bio": "go rust", "deleted_at": 1}
+	]`)
+}
+
+// jsonEqual compares JSON texts regardless of formatting and number representation.
+func jsonEqual(a, b string) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestMemoryQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		vars map[string]string
+		want string
+	}{
+		{
+			"eq",
+			`{ q(func: eq(name, "bob")) { name } }`,
+			nil,
+			`[{"name": "bob"}]`,
+		},
+		{
+			"eq by variable",
+			`query q($v0: int) { q(func: has(name)) @filter(eq(age, $v0)) { name } }`,
+			map[string]string{"$v0": "30"},
+			`[{"name": "bob"}]`,
+		},
+		{
+			"eq any of list",
+			`{ q(func: eq(name, ["alice", "carol"]), orderasc: name) { name } }`,
+			nil,
+			`[{"name": "alice"}, {"name": "carol"}]`,
+		},
+		{
+			"comparison",
+			`{ q(func: has(name), orderasc: age) @filter(ge(age, 30)) { name } }`,
+			nil,
+			`[{"name": "bob"}, {"name": "carol"}]`,
+		},
+		{
+			"has",
+			`{ q(func: has(follow)) { name } }`,
+			nil,
+			`[{"name": "alice"}]`,
+		},
+		{
+			"not has",
+			`{ q(func: has(name), orderasc: name) @filter(not has(deleted_at)) { name } }`,
+			nil,
+			`[{"name": "alice"}, {"name": "bob"}]`,
+		},
+		{
+			"and or",
+			`{ q(func: has(name), orderasc: name) @filter(eq(name, "alice") or eq(age, 30) and has(bio)) { name } }`,
+			nil,
+			`[{"name": "alice"}, {"name": "bob"}]`,
+		},
+		{
+			"regexp",
+			`{ q(func: has(name)) @filter(regexp(name, /^B/i)) { name } }`,
+			nil,
+			`[{"name": "bob"}]`,
+		},
+		{
+			"regexp by variable",
+			`query q($v0: string) { q(func: has(name)) @filter(regexp(name, $v0)) { name } }`,
+			map[string]string{"$v0": "/^c/"},
+			`[{"name": "carol"}]`,
+		},
+		{
+			"terms",
+			`{ q(func: has(name), orderasc: name) @filter(allofterms(bio, "rust go")) { name } }`,
+			nil,
+			`[{"name": "carol"}]`,
+		},
+		{
+			"orderdesc",
+			`{ q(func: has(name), orderdesc: age) { name } }`,
+			nil,
+			`[{"name": "carol"}, {"name": "bob"}, {"name": "alice"}]`,
+		},
+		{
+			"first offset",
+			`{ q(func: has(name), orderasc: age, first: 1, offset: 1) { name } }`,
+			nil,
+			`[{"name": "bob"}]`,
+		},
+		{
+			"after",
+			`{ q(func: has(name), after: <alice>) { name } }`,
+			nil,
+			`[{"name": "bob"}, {"name": "carol"}]`,
+		},
+		{
+			"uid",
+			`{ q(func: uid(<bob>, <carol>)) { name } }`,
+			nil,
+			`[{"name": "bob"}, {"name": "carol"}]`,
+		},
+		{
+			"uid by variable",
+			`query q($v0: string) { q(func: uid($v0)) { name } }`,
+			map[string]string{"$v0": "[<alice>, <carol>]"},
+			`[{"name": "alice"}, {"name": "carol"}]`,
+		},
+		{
+			"uid_in",
+			`{ q(func: has(name)) @filter(uid_in(follow, <carol>)) { name } }`,
+			nil,
+			`[{"name": "alice"}]`,
+		},
+		{
+			"edges with facets",
+			`{ q(func: uid(<alice>)) { follows: follow (orderasc: age) @facets(since: since) { name } } }`,
+			nil,
+			`[{"follows": [{"name": "bob", "since": 5}, {"name": "carol", "since": 10}]}]`,
+		},
+		{
+			"facets filter",
+			`{ q(func: uid(<alice>)) { follow @facets(ge(since, 7)) { name } } }`,
+			nil,
+			`[{"follow": [{"name": "carol"}]}]`,
+		},
+		{
+			"facets order",
+			`{ q(func: uid(<alice>)) { follow @facets(orderdesc: since) (first: 1) { name } } }`,
+			nil,
+			`[{"follow": [{"name": "carol"}]}]`,
+		},
+		{
+			"edge filter",
+			`{ q(func: uid(<alice>)) { follow @filter(not has(deleted_at)) { name } } }`,
+			nil,
+			`[{"follow": [{"name": "bob"}]}]`,
+		},
+		{
+			"count",
+			`{ q(func: has(name)) { count(uid) } }`,
+			nil,
+			`[{"count": 3}]`,
+		},
+		{
+			"count of edges",
+			`{ q(func: uid(<alice>)) { follow_count: count(follow) } }`,
+			nil,
+			`[{"follow_count": 2}]`,
+		},
+		{
+			"no result",
+			`{ q(func: eq(name, "dave")) { name } }`,
+			nil,
+			`[]`,
+		},
+	}
+
+	db := NewMemoryDatabase()
+	uids := seedUsers(t, db)
+	expand := func(q string) string {
+		for name, uid := range uids {
+			q = strings.ReplaceAll(q, "<"+name+">", uid)
+		}
+		return q
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			for name, value := range tt.vars {
+				vars[name] = expand(value)
+			}
+
+			res, err := db.Query(context.Background(), expand(tt.q), vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := json.Marshal(res)
+			if !jsonEqual(string(got), tt.want) {
+				t.Errorf("Query() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryQueryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+	}{
+		{"syntax", `{ q(func: has(name) { name } }`},
+		{"undefined variable", `query q($v0: string) { q(func: eq(name, $v1)) { name } }`},
+		{"unsupported function", `{ q(func: has(name)) @filter(unknown(name, 1)) { name } }`},
+	}
+
+	db := NewMemoryDatabase()
+	seedUsers(t, db)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Query(context.Background(), tt.q, map[string]string{})
+			if err == nil {
+				t.Errorf("Query() succeeded, want error")
+			}
+		})
+	}
+}
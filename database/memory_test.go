@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func TestMemoryTxnConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   string
+		second  string
+		aborted bool
+	}{
+		{"different nodes", `{"uid": "<a>", "name": "x"}`, `{"uid": "<b>", "name": "y"}`, false},
+		{"different predicates", `{"uid": "<a>", "name": "x"}`, `{"uid": "<a>", "age": 1}`, false},
+		{"same predicate", `{"uid": "<a>", "name": "x"}`, `{"uid": "<a>", "name": "y"}`, true},
+		{"different edges", `{"uid": "<a>", "follow": {"uid": "<b>"}}`, `{"uid": "<a>", "follow": {"uid": "<c>"}}`, false},
+		{"same edge", `{"uid": "<a>", "follow": {"uid": "<b>"}}`, `{"uid": "<a>", "follow": {"uid": "<b>", "follow|at": 1}}`, true},
+		{"new nodes", `{"uid": "_:n", "name": "x"}`, `{"uid": "_:n", "name": "y"}`, false},
+		{"same upsert value", `{"uid": "_:n", "code": "x"}`, `{"uid": "_:n", "code": "x"}`, true},
+		{"different upsert values", `{"uid": "_:n", "code": "x"}`, `{"uid": "_:n", "code": "y"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := NewMemoryDatabase()
+			if err := db.Migrate("code: string @index(exact) @upsert ."); err != nil {
+				t.Fatal(err)
+			}
+			uids := seed(t, db, `[{"uid": "_:a"}, {"uid": "_:b"}, {"uid": "_:c"}]`)
+			expand := func(q string) string {
+				for name, uid := range uids {
+					q = strings.ReplaceAll(q, "<"+name+">", uid)
+				}
+				return q
+			}
+
+			first, second := db.NewTxn(), db.NewTxn()
+			if _, err := first.Mutate(ctx, mutation(expand(tt.first))); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := second.Mutate(ctx, mutation(expand(tt.second))); err != nil {
+				t.Fatal(err)
+			}
+			if err := first.Commit(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			err := second.Commit(ctx)
+			if aborted := errors.HasCode(err, errors.TxnAborted); aborted != tt.aborted {
+				t.Errorf("Commit() = %v, want aborted %t", err, tt.aborted)
+			}
+		})
+	}
+}
+
+func TestMemoryTxnKeepsConcurrentCommits(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDatabase()
+	uids := seed(t, db, `[{"uid": "_:a", "name": "alice"}, {"uid": "_:b", "name": "bob"}]`)
+
+	first, second := db.NewTxn(), db.NewTxn()
+	first.Mutate(ctx, mutation(`{"uid": "`+uids["a"]+`", "age": 20}`))
+	second.Mutate(ctx, mutation(`{"uid": "`+uids["b"]+`", "age": 30}`))
+	if err := first.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.Query(ctx, `{ q(func: has(age), orderasc: age) { name age } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Errorf("Query() = %v, want both commits", res)
+	}
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nosukeru/graphor/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Environment variables read by OptionsFromEnv.
+const (
+	EnvAddrs            = "GRAPHOR_ADDRS"
+	EnvTLSCAFile        = "GRAPHOR_TLS_CA_FILE"
+	EnvTLSCertFile      = "GRAPHOR_TLS_CERT_FILE"
+	EnvTLSKeyFile       = "GRAPHOR_TLS_KEY_FILE"
+	EnvTLSServerName    = "GRAPHOR_TLS_SERVER_NAME"
+	EnvDialTimeout      = "GRAPHOR_DIAL_TIMEOUT"
+	EnvKeepaliveTime    = "GRAPHOR_KEEPALIVE_TIME"
+	EnvKeepaliveTimeout = "GRAPHOR_KEEPALIVE_TIMEOUT"
+	EnvMaxMessageSize   = "GRAPHOR_MAX_MESSAGE_SIZE"
+)
+
+// Options describes how to connect to dgraph Alpha nodes.
+type Options struct {
+	Addrs            []string      // Alpha addresses (host:port)
+	TLS              *TLSOptions   // nil for insecure connection
+	DialTimeout      time.Duration // 0 for non-blocking dial
+	KeepaliveTime    time.Duration // 0 to disable keepalive pings
+	KeepaliveTimeout time.Duration
+	MaxMessageSize   int // max send/receive message size in bytes, 0 for grpc default
+}
+
+type TLSOptions struct {
+	CAFile     string // CA certificate to verify server, system pool if empty
+	CertFile   string // client certificate for mutual TLS
+	KeyFile    string
+	ServerName string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Addrs: []string{"localhost:9080"},
+	}
+}
+
+// OptionsFromEnv returns DefaultOptions overridden by GRAPHOR_* environment variables.
+func OptionsFromEnv() (Options, error) {
+	opts := DefaultOptions()
+
+	if v := os.Getenv(EnvAddrs); v != "" {
+		opts.Addrs = []string{}
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				opts.Addrs = append(opts.Addrs, addr)
+			}
+		}
+	}
+
+	tlsOpts := TLSOptions{
+		CAFile:     os.Getenv(EnvTLSCAFile),
+		CertFile:   os.Getenv(EnvTLSCertFile),
+		KeyFile:    os.Getenv(EnvTLSKeyFile),
+		ServerName: os.Getenv(EnvTLSServerName),
+	}
+	if tlsOpts != (TLSOptions{}) {
+		opts.TLS = &tlsOpts
+	}
+
+	durations := map[string]*time.Duration{
+		EnvDialTimeout:      &opts.DialTimeout,
+		EnvKeepaliveTime:    &opts.KeepaliveTime,
+		EnvKeepaliveTimeout: &opts.KeepaliveTimeout,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return opts, errors.New(errors.InvalidOptions, err.Error()).Add(name, v)
+			}
+			*d = parsed
+		}
+	}
+
+	if v := os.Getenv(EnvMaxMessageSize); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New(errors.InvalidOptions, err.Error()).Add(EnvMaxMessageSize, v)
+		}
+		opts.MaxMessageSize = size
+	}
+
+	return opts, nil
+}
+
+func (opts Options) dialOptions() ([]grpc.DialOption, error) {
+	dialOpts := []grpc.DialOption{}
+
+	if opts.TLS != nil {
+		config, err := opts.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+
+	if opts.DialTimeout > 0 {
+		dialOpts = append(dialOpts, grpc.WithBlock())
+	}
+
+	if opts.KeepaliveTime > 0 {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    opts.KeepaliveTime,
+			Timeout: opts.KeepaliveTimeout,
+		}))
+	}
+
+	if opts.MaxMessageSize > 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(opts.MaxMessageSize),
+			grpc.MaxCallSendMsgSize(opts.MaxMessageSize),
+		))
+	}
+
+	return dialOpts, nil
+}
+
+func (t *TLSOptions) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: t.ServerName,
+	}
+
+	if t.CAFile != "" {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.New(errors.InvalidOptions, err.Error()).Add("caFile", t.CAFile)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New(errors.InvalidOptions, "Invalid CA certificate.").Add("caFile", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.New(errors.InvalidOptions, err.Error()).Add("certFile", t.CertFile).Add("keyFile", t.KeyFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
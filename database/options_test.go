@@ -0,0 +1,112 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Options
+		err  bool
+	}{
+		{"default", nil, DefaultOptions(), false},
+		{
+			"addrs",
+			map[string]string{EnvAddrs: "alpha1:9080, alpha2:9080,"},
+			Options{Addrs: []string{"alpha1:9080", "alpha2:9080"}},
+			false,
+		},
+		{
+			"tls",
+			map[string]string{EnvTLSCAFile: "ca.crt", EnvTLSServerName: "dgraph"},
+			Options{Addrs: []string{"localhost:9080"}, TLS: &TLSOptions{CAFile: "ca.crt", ServerName: "dgraph"}},
+			false,
+		},
+		{
+			"durations and size",
+			map[string]string{EnvDialTimeout: "5s", EnvKeepaliveTime: "1m", EnvKeepaliveTimeout: "10s", EnvMaxMessageSize: "1024"},
+			Options{Addrs: []string{"localhost:9080"}, DialTimeout: 5 * time.Second, KeepaliveTime: time.Minute, KeepaliveTimeout: 10 * time.Second, MaxMessageSize: 1024},
+			false,
+		},
+		{"invalid duration", map[string]string{EnvDialTimeout: "5"}, Options{}, true},
+		{"invalid size", map[string]string{EnvMaxMessageSize: "1KB"}, Options{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{EnvAddrs, EnvTLSCAFile, EnvTLSCertFile, EnvTLSKeyFile, EnvTLSServerName, EnvDialTimeout, EnvKeepaliveTime, EnvKeepaliveTimeout, EnvMaxMessageSize} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			opts, err := OptionsFromEnv()
+			if tt.err {
+				if !errors.HasCode(err, errors.InvalidOptions) {
+					t.Errorf("OptionsFromEnv() = %v, want InvalidOptions", err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("OptionsFromEnv() = %+v, %v; want %+v", opts, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		count int
+		err   bool
+	}{
+		{"insecure", Options{}, 1, false},
+		{"blocking dial", Options{DialTimeout: time.Second}, 2, false},
+		{"keepalive", Options{KeepaliveTime: time.Minute}, 2, false},
+		{"message size", Options{MaxMessageSize: 1024}, 2, false},
+		{"tls", Options{TLS: &TLSOptions{ServerName: "dgraph"}}, 1, false},
+		{"missing ca file", Options{TLS: &TLSOptions{CAFile: "testdata/missing.crt"}}, 0, true},
+		{"missing key pair", Options{TLS: &TLSOptions{CertFile: "testdata/missing.crt"}}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialOpts, err := tt.opts.dialOptions()
+			if tt.err {
+				if !errors.HasCode(err, errors.InvalidOptions) {
+					t.Errorf("dialOptions() = %v, want InvalidOptions", err)
+				}
+				return
+			}
+			if err != nil || len(dialOpts) != tt.count {
+				t.Errorf("dialOptions() = %d options, %v; want %d", len(dialOpts), err, tt.count)
+			}
+		})
+	}
+}
+
+func TestNewDatabaseRejectsSeveralOptions(t *testing.T) {
+	_, err := NewDatabase(DefaultOptions(), DefaultOptions())
+	if !errors.HasCode(err, errors.InvalidOptions) {
+		t.Errorf("NewDatabase() = %v, want InvalidOptions", err)
+	}
+}
+
+func TestDatabaseClose(t *testing.T) {
+	// non-blocking dial succeeds without dgraph running
+	db, err := NewDatabase(Options{Addrs: []string{"localhost:9080", "localhost:9081"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(db.(*database).conns); n != 2 {
+		t.Fatalf("NewDatabase() kept %d connections, want 2", n)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/dgraph-io/dgo/y"
+	"github.com/nosukeru/graphor/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Txn is a read-write transaction. Queries see mutations made earlier in the same transaction.
+// vars are GraphQL+- query variables (e.g. {"$name": "alice"}), or nil.
+type Txn interface {
+	Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error)
+	QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error)
+	Mutate(ctx context.Context, m *Mutation) (map[string]string, error)
+	Commit(ctx context.Context) error
+	Discard(ctx context.Context)
+}
+
+type txn struct {
+	Txn *dgo.Txn
+}
+
+func (t *txn) Query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error) {
+	body, err := t.QueryJSON(ctx, q, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse(body)
+}
+
+func (t *txn) QueryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) {
+	res, err := t.Txn.QueryWithVars(ctx, q, vars)
+	if err != nil {
+		return nil, wrapError(errors.QueryFailed, err).Add("q", q).Add("vars", fmt.Sprint(vars))
+	}
+
+	return res.Json, nil
+}
+
+// decodeResponse extracts results of query block "q" from response JSON.
+func decodeResponse(body []byte) ([]interface{}, error) {
+	// keep numbers as json.Number, so that int64 and float values are decoded losslessly
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var r interface{}
+	err := decoder.Decode(&r)
+
+	if err != nil {
+		return nil, errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(body))
+	}
+
+	data := r.(map[string]interface{})["q"]
+	if data == nil {
+		return []interface{}{}, nil
+	}
+
+	results := data.([]interface{})
+
+	// groupby
+	if len(results) > 0 {
+		if ar, ok := results[0].(map[string]interface{})["@groupby"]; ok {
+			return ar.([]interface{}), nil
+		}
+	}
+
+	return results, nil
+}
+
+func (t *txn) Mutate(ctx context.Context, m *Mutation) (map[string]string, error) {
+	// delete
+	if len(m.Deletions) > 0 {
+		mu := new(api.Mutation)
+		deletion := fmt.Sprintf("[%s]", strings.Join(m.Deletions, ","))
+
+		mu.DeleteJson = []byte(deletion)
+		_, err := t.Txn.Mutate(ctx, mu)
+
+		if err != nil {
+			return nil, wrapError(errors.DeletionFailed, err).Add("deletion", deletion)
+		}
+	}
+
+	// set
+	uids := map[string]string{}
+
+	if len(m.Insertions) > 0 {
+		mu := new(api.Mutation)
+		insertion := fmt.Sprintf("[%s]", strings.Join(m.Insertions, ","))
+
+		mu.SetJson = []byte(insertion)
+		res, err := t.Txn.Mutate(ctx, mu)
+
+		if err != nil {
+			return nil, wrapError(errors.InsertionFailed, err).Add("insertion", insertion)
+		}
+
+		uids = res.Uids
+	}
+
+	return uids, nil
+}
+
+func (t *txn) Commit(ctx context.Context) error {
+	err := t.Txn.Commit(ctx)
+	if err != nil {
+		return wrapError(errors.MutationCommitFailed, err)
+	}
+	return nil
+}
+
+func (t *txn) Discard(ctx context.Context) {
+	t.Txn.Discard(ctx)
+}
+
+// wrapError reports transaction conflicts as errors.TxnAborted so that callers can retry.
+func wrapError(code int, err error) errors.Error {
+	if err == y.ErrAborted {
+		code = errors.TxnAborted
+	} else if s, ok := status.FromError(err); ok && s.Code() == codes.Aborted {
+		code = errors.TxnAborted
+	}
+
+	return errors.New(code, err.Error())
+}
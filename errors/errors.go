@@ -12,6 +12,13 @@ const (
 	QueryFailed
 	UnmarshalizeFailed
 	NoUidReturned
+	InvalidOptions
+	TxnAborted
+	InvalidUpsertKey
+	UniqueViolation
+	MigrationNotFound
+	IrreversibleMigration
+	InvalidQuery
 )
 
 type Error interface {
@@ -49,3 +56,9 @@ func (err *_Error) Error() string {
 
 	return message
 }
+
+// HasCode reports whether err is an Error of given code.
+func HasCode(err error, code int) bool {
+	e, ok := err.(*_Error)
+	return ok && e.Code == code
+}
@@ -0,0 +1,235 @@
+package graphor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+// Expr is a filter expression built by Eq, AnyOfTerms, Not, And, ... and applied by Query.Filter.
+type Expr interface {
+	// compile renders the expression into GraphQL+- filter, adding its values to vars.
+	compile(schema Schema, vars *variables) (string, error)
+}
+
+// functionIndexes lists tokenizers any of which is required to run the function on a field.
+var functionIndexes = map[string][]string{
+	"eq":         {"exact", "hash", "term", "fulltext", "int", "float", "bool", "year", "month", "day", "hour"},
+	"lt":         {"exact", "int", "float", "year", "month", "day", "hour"},
+	"le":         {"exact", "int", "float", "year", "month", "day", "hour"},
+	"gt":         {"exact", "int", "float", "year", "month", "day", "hour"},
+	"ge":         {"exact", "int", "float", "year", "month", "day", "hour"},
+	"anyofterms": {"term"},
+	"allofterms": {"term"},
+	"anyoftext":  {"fulltext"},
+	"alloftext":  {"fulltext"},
+	"match":      {"trigram"},
+	"regexp":     {"trigram"},
+	"near":       {"geo"},
+	"within":     {"geo"},
+	"contains":   {"geo"},
+	"intersects": {"geo"},
+}
+
+// checkIndex verifies that field has an index required by function fn.
+// Fields without FieldSchema (e.g. listed in Fields) are not checked.
+func (s Schema) checkIndex(method string, fn string, field string) error {
+	name := strings.SplitN(field, "@", 2)[0]
+
+	fs, ok := s.FieldSchemas[name]
+	tokenizers, required := functionIndexes[fn]
+	if !ok || !required {
+		return nil
+	}
+
+	for _, tokenizer := range tokenizers {
+		for _, index := range fs.predicate(name).Index {
+			if index == tokenizer {
+				return nil
+			}
+		}
+	}
+
+	return errors.New(errors.InvalidQuery, fmt.Sprintf("%s failed: %s requires %s index.", method, fn, strings.Join(tokenizers, " or "))).Add("field", field)
+}
+
+// indexOf returns the first of tokenizers which field is indexed by in FieldSchemas.
+// As in checkIndex, fields without FieldSchema are not checked and assumed to have the first of tokenizers.
+func (s Schema) indexOf(method string, field string, tokenizers ...string) (string, error) {
+	name := strings.SplitN(field, "@", 2)[0]
+
+	fs, ok := s.FieldSchemas[name]
+	if !ok {
+		return tokenizers[0], nil
+	}
+
+	for _, tokenizer := range tokenizers {
+		for _, index := range fs.predicate(name).Index {
+			if index == tokenizer {
+				return tokenizer, nil
+			}
+		}
+	}
+
+	return "", errors.New(errors.InvalidQuery, fmt.Sprintf("%s failed: %s index is required.", method, strings.Join(tokenizers, " or "))).Add("field", field)
+}
+
+type funcExpr struct {
+	Func  string
+	Field string
+	Args  []interface{} // passed as variables, except Raw
+}
+
+func (e funcExpr) compile(schema Schema, vars *variables) (string, error) {
+	if !isSafeToken(e.Field) {
+		return "", invalidQuery("Filter", "field", e.Field).Add("func", e.Func)
+	}
+	if err := schema.checkIndex("Filter", e.Func, e.Field); err != nil {
+		return "", err
+	}
+
+	args := []string{e.Field}
+	for _, arg := range e.Args {
+		if raw, ok := arg.(Raw); ok {
+			args = append(args, string(raw))
+		} else {
+			name, err := vars.add(arg)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, name)
+		}
+	}
+
+	return fmt.Sprintf("%s(%s)", e.Func, strings.Join(args, ", ")), nil
+}
+
+type notExpr struct {
+	Expr Expr
+}
+
+func (e notExpr) compile(schema Schema, vars *variables) (string, error) {
+	filter, err := e.Expr.compile(schema, vars)
+	if err != nil {
+		return "", err
+	}
+	return "not " + filter, nil
+}
+
+type logicalExpr struct {
+	Op    string // and, or
+	Exprs []Expr
+}
+
+func (e logicalExpr) compile(schema Schema, vars *variables) (string, error) {
+	if len(e.Exprs) == 0 {
+		return "", errors.New(errors.InvalidQuery, "Filter failed: Empty expression.").Add("op", e.Op)
+	}
+
+	filters := []string{}
+	for _, expr := range e.Exprs {
+		filter, err := expr.compile(schema, vars)
+		if err != nil {
+			return "", err
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return "(" + strings.Join(filters, " "+e.Op+" ") + ")", nil
+}
+
+func Eq(field string, value interface{}) Expr {
+	return funcExpr{"eq", field, []interface{}{value}}
+}
+
+func Lt(field string, value interface{}) Expr {
+	return funcExpr{"lt", field, []interface{}{value}}
+}
+
+func Le(field string, value interface{}) Expr {
+	return funcExpr{"le", field, []interface{}{value}}
+}
+
+func Gt(field string, value interface{}) Expr {
+	return funcExpr{"gt", field, []interface{}{value}}
+}
+
+func Ge(field string, value interface{}) Expr {
+	return funcExpr{"ge", field, []interface{}{value}}
+}
+
+// AnyOfTerms matches field having any of space separated terms (requires term index).
+func AnyOfTerms(field string, terms string) Expr {
+	return funcExpr{"anyofterms", field, []interface{}{terms}}
+}
+
+func AllOfTerms(field string, terms string) Expr {
+	return funcExpr{"allofterms", field, []interface{}{terms}}
+}
+
+// AnyOfText is full-text search with stemming and stop words (requires fulltext index).
+func AnyOfText(field string, text string) Expr {
+	return funcExpr{"anyoftext", field, []interface{}{text}}
+}
+
+func AllOfText(field string, text string) Expr {
+	return funcExpr{"alloftext", field, []interface{}{text}}
+}
+
+// Match is fuzzy matching within Levenshtein distance (requires trigram index).
+func Match(field string, value string, distance int) Expr {
+	return funcExpr{"match", field, []interface{}{value, Raw(fmt.Sprintf("%d", distance))}}
+}
+
+func Has(edge string) Expr {
+	return funcExpr{"has", edge, nil}
+}
+
+// UidIn matches nodes having edge to any of uids.
+func UidIn(edge string, uids ...string) Expr {
+	if len(uids) == 0 || !isValidUid(uids...) {
+		uids = []string{"0x0"} // dummy uid
+	}
+
+	exprs := []Expr{}
+	for _, uid := range uids {
+		exprs = append(exprs, funcExpr{"uid_in", edge, []interface{}{Raw(uid)}})
+	}
+	return Or(exprs...)
+}
+
+// Near matches geo field within meters from point (requires geo index).
+func Near(field string, point GeoPoint, meters float64) Expr {
+	return funcExpr{"near", field, []interface{}{Raw(point.text()), Raw(formatFloat(meters))}}
+}
+
+// Within matches geo field inside polygon (requires geo index).
+func Within(field string, polygon Polygon) Expr {
+	return funcExpr{"within", field, []interface{}{Raw(polygon.text())}}
+}
+
+// Contains matches geo field (polygon) containing geometry (requires geo index).
+func Contains(field string, geometry Geometry) Expr {
+	return funcExpr{"contains", field, []interface{}{Raw(geometry.text())}}
+}
+
+// Intersects matches geo field intersecting polygon (requires geo index).
+func Intersects(field string, polygon Polygon) Expr {
+	return funcExpr{"intersects", field, []interface{}{Raw(polygon.text())}}
+}
+
+func Not(expr Expr) Expr {
+	return notExpr{expr}
+}
+
+func And(exprs ...Expr) Expr {
+	return logicalExpr{"and", exprs}
+}
+
+func Or(exprs ...Expr) Expr {
+	return logicalExpr{"or", exprs}
+}
@@ -0,0 +1,340 @@
+package graphor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+// rawQuery is implemented by queries which can return raw JSON of resulting nodes.
+type rawQuery interface {
+	executeJSON(ctx context.Context) ([]json.RawMessage, error)
+	base() *query
+}
+
+func (q *query) base() *query {
+	return q
+}
+
+var modelFieldsCache sync.Map // reflect.Type -> map[string][]int
+
+// Find executes q and decodes results directly into models of type T (e.g. *User).
+// Unlike AsX helpers with Init, it doesn't go through QueryData.
+func Find[T Model](q Query) ([]T, error) {
+	ctx := context.Background()
+	if rq, ok := q.(rawQuery); ok {
+		ctx = rq.base().context()
+	}
+	return FindContext[T](ctx, q)
+}
+
+func FindContext[T Model](ctx context.Context, q Query) ([]T, error) {
+	typ, err := modelType[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	rq, ok := q.(rawQuery)
+	if !ok {
+		dataList, err := q.AllContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		models := make([]T, 0, len(dataList))
+		for _, data := range dataList {
+			model := reflect.New(typ).Interface().(T)
+			Init(model, data)
+			models = append(models, model)
+		}
+		return models, nil
+	}
+
+	nodes, err := rq.executeJSON(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := rq.base().Schema
+	models := make([]T, 0, len(nodes))
+	for _, node := range nodes {
+		model := reflect.New(typ)
+		err := decodeModel(node, schema, model)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model.Interface().(T))
+	}
+
+	return models, nil
+}
+
+// FindOne is Find for the first result. It returns nil model if nothing matches.
+func FindOne[T Model](q Query) (T, error) {
+	ctx := context.Background()
+	if rq, ok := q.(rawQuery); ok {
+		ctx = rq.base().context()
+	}
+	return FindOneContext[T](ctx, q)
+}
+
+func FindOneContext[T Model](ctx context.Context, q Query) (T, error) {
+	var model T
+
+	models, err := FindContext[T](ctx, q.Take(1))
+	if err != nil || len(models) == 0 {
+		return model, err
+	}
+
+	return models[0], nil
+}
+
+// TypedRelation is a Relation whose children are models of type T (e.g. *User), as returned by HasY
+// helpers of graphor-gen. Query methods (Where, Take, ...) are the ones of Relation.
+type TypedRelation[T Model] struct {
+	Relation
+}
+
+func (r TypedRelation[T]) Find() ([]T, error) {
+	return Find[T](r.Relation)
+}
+
+func (r TypedRelation[T]) FindContext(ctx context.Context) ([]T, error) {
+	return FindContext[T](ctx, r.Relation)
+}
+
+func (r TypedRelation[T]) FindOne() (T, error) {
+	return FindOne[T](r.Relation)
+}
+
+func (r TypedRelation[T]) FindOneContext(ctx context.Context) (T, error) {
+	return FindOneContext[T](ctx, r.Relation)
+}
+
+// modelType returns struct type which T points to.
+func modelType[T Model]() (reflect.Type, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.New(errors.UnmarshalizeFailed, "Find failed: Model must be a pointer to struct.").Add("type", t.String())
+	}
+	return t.Elem(), nil
+}
+
+// decodeModel decodes node into model (pointer to struct), as Init does for QueryData.
+// The node is parsed once: GetData() holds it decoded as Schema.Decode does (numbers as json.Number),
+// and fields are assigned from the same values.
+func decodeModel(raw json.RawMessage, schema Schema, model reflect.Value) error {
+	node := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&node); err != nil {
+		return errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(raw))
+	}
+
+	return assignModel(schema.Decode(node), schema, model)
+}
+
+// assignModel sets metadata and fields of model (pointer to struct) from data decoded by schema.
+func assignModel(data QueryData, schema Schema, model reflect.Value) error {
+	m := model.Interface().(Model)
+	uid, _ := data["uid"].(string)
+	m.SetUid(uid)
+	m.setCreatedAt(decodeInt(data["created_at"]))
+	m.setUpdatedAt(decodeInt(data["updated_at"]))
+	m.setDeletedAt(decodeInt(data["deleted_at"]))
+
+	fields := modelFields(model.Type().Elem())
+	for key, value := range data {
+		index, ok := fields[key]
+		if !ok {
+			continue
+		}
+		field := model.Elem().FieldByIndex(index)
+
+		var err error
+		if r, ok := schema.Relations[key]; ok && r.Include {
+			err = assignRelation(value, r, field)
+		} else {
+			err = assignValue(field, value)
+		}
+		if err != nil {
+			return errors.New(errors.UnmarshalizeFailed, err.Error()).Add("field", key).Add("body", toJSON(value))
+		}
+	}
+
+	for name, r := range schema.Relations {
+		if index, ok := fields[name]; ok && r.Include && r.HasMany {
+			if field := model.Elem().FieldByIndex(index); field.Kind() == reflect.Slice && field.IsNil() {
+				field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+			}
+		}
+	}
+
+	m.setData(data)
+	return nil
+}
+
+// assignRelation sets included relation models, which Schema.Decode has already decoded.
+func assignRelation(value interface{}, r RelationSchema, field reflect.Value) error {
+	children, ok := value.([]interface{})
+	if !ok {
+		children = []interface{}{value}
+	}
+
+	schema := r.SchemaFunc()
+
+	if field.Kind() == reflect.Slice {
+		list := reflect.MakeSlice(field.Type(), 0, len(children))
+		for _, child := range children {
+			v, err := assignChild(child, schema, field.Type().Elem())
+			if err != nil {
+				return err
+			}
+			list = reflect.Append(list, v)
+		}
+		field.Set(list)
+		return nil
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	v, err := assignChild(children[0], schema, field.Type())
+	if err != nil {
+		return err
+	}
+	field.Set(v)
+	return nil
+}
+
+func assignChild(child interface{}, schema Schema, t reflect.Type) (reflect.Value, error) {
+	elem := t
+	if t.Kind() == reflect.Ptr {
+		elem = t.Elem()
+	}
+
+	v := reflect.New(elem)
+	data, isData := child.(QueryData)
+	if v.Type().Implements(modelInterface) && isData {
+		if err := assignModel(data, schema, v); err != nil {
+			return v, err
+		}
+	} else if err := assignValue(v.Elem(), child); err != nil {
+		return v, err
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return v, nil
+	}
+	return v.Elem(), nil
+}
+
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// assignValue sets field to decoded JSON value as json.Unmarshal does. Scalars and slices are
+// converted directly; other types (structs, maps, json.Unmarshaler, ...) go through JSON again.
+func assignValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		return nil // null leaves field as is
+	}
+	if field.Addr().Type().Implements(jsonUnmarshaler) {
+		return reassign(field, value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			field.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			field.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := value.(json.Number); ok {
+			if i, err := strconv.ParseInt(string(n), 10, 64); err == nil && !field.OverflowInt(i) {
+				field.SetInt(i)
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := value.(json.Number); ok {
+			if i, err := strconv.ParseUint(string(n), 10, 64); err == nil && !field.OverflowUint(i) {
+				field.SetUint(i)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := value.(json.Number); ok {
+			if f, err := strconv.ParseFloat(string(n), field.Type().Bits()); err == nil {
+				field.SetFloat(f)
+				return nil
+			}
+		}
+	case reflect.Ptr:
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return assignValue(field.Elem(), value)
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok || field.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		res := reflect.MakeSlice(field.Type(), len(list), len(list))
+		for i, v := range list {
+			if err := assignValue(res.Index(i), v); err != nil {
+				return err
+			}
+		}
+		field.Set(res)
+		return nil
+	}
+
+	// mismatched or composite values, reported or decoded by encoding/json
+	return reassign(field, value)
+}
+
+func reassign(field reflect.Value, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, field.Addr().Interface())
+}
+
+// modelFields maps json names of (promoted) exported fields of struct t to their indexes.
+func modelFields(t reflect.Type) map[string][]int {
+	if cached, ok := modelFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	fields := map[string][]int{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || (f.Anonymous && f.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+
+		// shallower field wins, as encoding/json does
+		if index, ok := fields[name]; ok && len(index) <= len(f.Index) {
+			continue
+		}
+		fields[name] = f.Index
+	}
+
+	cached, _ := modelFieldsCache.LoadOrStore(t, fields)
+	return cached.(map[string][]int)
+}
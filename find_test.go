@@ -0,0 +1,124 @@
+package graphor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindDataMatchesInit(t *testing.T) {
+	c := newTestClient()
+	saveTestUsers(t, c, "alice")
+
+	found, err := FindOne[*testUser](c.BuildQuery(testUserSchema()))
+	if err != nil || found == nil {
+		t.Fatalf("FindOne() = %v, %v", found, err)
+	}
+
+	data, err := c.BuildQuery(testUserSchema()).First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initialized := &testUser{}
+	Init(initialized, data)
+
+	if !reflect.DeepEqual(found.GetData(), initialized.GetData()) {
+		t.Errorf("GetData() after Find = %v, after Init = %v", found.GetData(), initialized.GetData())
+	}
+	if _, ok := found.GetData()["created_at"].(json.Number); !ok {
+		t.Errorf("created_at = %T, want json.Number", found.GetData()["created_at"])
+	}
+	if found.Name != "alice" || found.GetCreatedAt() != initialized.GetCreatedAt() {
+		t.Errorf("Find() = %+v, want %+v", found, initialized)
+	}
+}
+
+func TestAssignValue(t *testing.T) {
+	type nested struct {
+		A int `json:"a"`
+	}
+	n := func(s string) json.Number { return json.Number(s) }
+	day := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		field interface{} // pointer to the field
+		value interface{}
+		want  interface{}
+		err   bool
+	}{
+		{"string", new(string), "a", "a", false},
+		{"bool", new(bool), true, true, false},
+		{"int", new(int), n("42"), 42, false},
+		{"int32", new(int32), n("-7"), int32(-7), false},
+		{"uint", new(uint), n("7"), uint(7), false},
+		{"float32", new(float32), n("1.5"), float32(1.5), false},
+		{"float64", new(float64), n("1e3"), float64(1000), false},
+		{"pointer", new(*int), n("3"), func() *int { i := 3; return &i }(), false},
+		{"string list", new([]string), []interface{}{"a", "b"}, []string{"a", "b"}, false},
+		{"bytes", new([]byte), "aGk=", []byte("hi"), false},
+		{"time", new(time.Time), "2020-01-02T00:00:00Z", day, false},
+		{"struct", new(nested), map[string]interface{}{"a": n("1")}, nested{1}, false},
+		{"interface", new(interface{}), n("1"), float64(1), false},
+		{"null", new(string), nil, "", false},
+		{"fraction into int", new(int), n("1.5"), 0, true},
+		{"overflow", new(int8), n("300"), int8(0), true},
+		{"string into int", new(int), "1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := reflect.ValueOf(tt.field).Elem()
+			err := assignValue(field, tt.value)
+			if (err != nil) != tt.err {
+				t.Fatalf("assignValue() = %v, want error %t", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(field.Interface(), tt.want) {
+				t.Errorf("assignValue() set %#v, want %#v", field.Interface(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFindIncludedRelations(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob", "carol")
+	schema := testUserSchema()
+	follows := schema.Relations["follows"]
+
+	err := c.Mutate(func(m *Mutation) error {
+		c.BuildRelation(users[0], follows).Add(m, users[1], map[string]interface{}{"since": 5})
+		c.BuildRelation(users[0], follows).Add(m, users[2])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follows.Include = true
+	schema.Relations["follows"] = follows
+
+	found, err := Find[*testUser](c.BuildQuery(schema).SetSortOption("name", "asc"))
+	if err != nil || len(found) != 3 {
+		t.Fatalf("Find() = %d users, %v; want 3", len(found), err)
+	}
+
+	alice, bob := found[0], found[1]
+	if len(alice.Follows) != 2 || alice.Follows[0].GetUid() == "" || alice.Follows[0].Name == "" || alice.Follows[0].Age == 0 {
+		t.Errorf("Follows = %+v, want decoded models", alice.Follows)
+	}
+	if bob.Follows == nil || len(bob.Follows) != 0 {
+		t.Errorf("Follows = %#v, want empty list", bob.Follows)
+	}
+
+	children, ok := alice.GetData()["follows"].([]interface{})
+	if !ok || len(children) != 2 {
+		t.Fatalf(`GetData()["follows"] = %#v, want decoded children`, alice.GetData()["follows"])
+	}
+	for i, child := range children {
+		if !reflect.DeepEqual(child, alice.Follows[i].GetData()) {
+			t.Errorf("GetData() of child = %v, want %v", alice.Follows[i].GetData(), child)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package graphor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Geometry is a value of geo field, GeoPoint or Polygon.
+type Geometry interface {
+	text() string
+}
+
+// GeoPoint is a point of geo field in longitude and latitude.
+// It is saved as GeoJSON; use *GeoPoint for optional field, since zero value is a valid point.
+type GeoPoint struct {
+	Lng float64
+	Lat float64
+}
+
+// Polygon is a list of linear rings of GeoPoints, the first one of which is the outer boundary
+// and the others are holes. Each ring should be closed (the last point equals to the first).
+type Polygon [][]GeoPoint
+
+var (
+	geoPointType = reflect.TypeOf(GeoPoint{})
+	polygonType  = reflect.TypeOf(Polygon{})
+)
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// text renders p as coordinates in GraphQL+- (e.g. "[139.7, 35.6]").
+func (p GeoPoint) text() string {
+	return "[" + formatFloat(p.Lng) + ", " + formatFloat(p.Lat) + "]"
+}
+
+func (p GeoPoint) coordinates() [2]float64 {
+	return [2]float64{p.Lng, p.Lat}
+}
+
+func (p GeoPoint) MarshalJSON() ([]byte, error) {
+	coordinates, _ := json.Marshal(p.coordinates())
+	return json.Marshal(geoJSON{"Point", coordinates})
+}
+
+func (p *GeoPoint) UnmarshalJSON(b []byte) error {
+	coordinates := [2]float64{}
+	if err := unmarshalGeoJSON(b, "Point", &coordinates); err != nil {
+		return err
+	}
+
+	p.Lng, p.Lat = coordinates[0], coordinates[1]
+	return nil
+}
+
+func (p Polygon) text() string {
+	rings := []string{}
+	for _, ring := range p {
+		points := []string{}
+		for _, point := range ring {
+			points = append(points, point.text())
+		}
+		rings = append(rings, "["+strings.Join(points, ", ")+"]")
+	}
+	return "[" + strings.Join(rings, ", ") + "]"
+}
+
+func (p Polygon) MarshalJSON() ([]byte, error) {
+	if p == nil {
+		return []byte("null"), nil
+	}
+
+	rings := [][][2]float64{}
+	for _, ring := range p {
+		points := [][2]float64{}
+		for _, point := range ring {
+			points = append(points, point.coordinates())
+		}
+		rings = append(rings, points)
+	}
+
+	coordinates, _ := json.Marshal(rings)
+	return json.Marshal(geoJSON{"Polygon", coordinates})
+}
+
+func (p *Polygon) UnmarshalJSON(b []byte) error {
+	rings := [][][2]float64{}
+	if err := unmarshalGeoJSON(b, "Polygon", &rings); err != nil {
+		return err
+	}
+
+	*p = Polygon{}
+	for _, ring := range rings {
+		points := []GeoPoint{}
+		for _, c := range ring {
+			points = append(points, GeoPoint{c[0], c[1]})
+		}
+		*p = append(*p, points)
+	}
+	return nil
+}
+
+// unmarshalGeoJSON decodes coordinates of GeoJSON b of type typ. null is left as it is.
+func unmarshalGeoJSON(b []byte, typ string, coordinates interface{}) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	g := geoJSON{}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return err
+	}
+	if g.Type != typ {
+		return fmt.Errorf("graphor: %s is expected, but got GeoJSON of type %q", typ, g.Type)
+	}
+
+	return json.Unmarshal(g.Coordinates, coordinates)
+}
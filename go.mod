@@ -1,9 +1,17 @@
 module github.com/nosukeru/graphor
 
-go 1.12
+go 1.18
 
 require (
 	github.com/dgraph-io/dgo v0.0.0-20190501005019-7517ac021e22
-	github.com/pkg/errors v0.8.1 // indirect
 	google.golang.org/grpc v1.21.0
 )
+
+require (
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a // indirect
+	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20180817151627-c66870c02cf8 // indirect
+)
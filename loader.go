@@ -0,0 +1,173 @@
+package graphor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RelationLoader batches relation queries of many parents into a single query,
+// e.g. follows of every user in a list.
+type RelationLoader struct {
+	Client         *Client
+	RelationSchema RelationSchema
+	Scopes         []func(q Query) Query // applied per parent, e.g. Take(3) takes 3 children of each parent
+	Wait           time.Duration         // window to collect parents of concurrent Load calls
+	MaxBatch       int                   // dispatch early when this many parents are collected, 0 for unlimited
+
+	mutex   sync.Mutex
+	pending *loaderBatch
+}
+
+type loaderBatch struct {
+	ctx       context.Context // of the first call, for its values
+	deadline  time.Time       // latest deadline of calls
+	unbounded bool            // whether any call has no deadline
+	parents   []Model
+	done      chan struct{}
+	results   map[string][]QueryData
+	err       error
+}
+
+const defaultLoaderWait = 2 * time.Millisecond
+
+func (g *Client) NewRelationLoader(rs RelationSchema, scopes ...func(q Query) Query) *RelationLoader {
+	return &RelationLoader{
+		Client:         g,
+		RelationSchema: rs,
+		Scopes:         scopes,
+		Wait:           defaultLoaderWait,
+	}
+}
+
+func (l *RelationLoader) LoadAll(parents []Model) (map[string][]QueryData, error) {
+	return l.LoadAllContext(context.Background(), parents)
+}
+
+// LoadAllContext queries relation of all parents at once, returning children keyed by parent uid.
+func (l *RelationLoader) LoadAllContext(ctx context.Context, parents []Model) (map[string][]QueryData, error) {
+	results := map[string][]QueryData{}
+	uids := []string{}
+
+	for _, parent := range parents {
+		if parent == nil || !parent.isSaved() {
+			continue
+		}
+
+		uid := parent.GetUid()
+		if _, ok := results[uid]; !ok {
+			results[uid] = []QueryData{}
+			uids = append(uids, uid)
+		}
+	}
+
+	if len(uids) == 0 {
+		return results, nil
+	}
+
+	r := newRelation(l.Client, l.RelationSchema, uids...)
+	for _, scope := range l.Scopes {
+		scope(r)
+	}
+
+	res, err := r.ExecuteContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range res {
+		parent := obj.(map[string]interface{})
+		uid := decodeString(parent["uid"])
+		children, _ := parent[l.RelationSchema.Edge].([]interface{})
+
+		for _, child := range children {
+			results[uid] = append(results[uid], r.Schema.Decode(child))
+		}
+	}
+
+	return results, nil
+}
+
+func (l *RelationLoader) Load(parent Model) ([]QueryData, error) {
+	return l.LoadContext(context.Background(), parent)
+}
+
+// LoadContext returns children of parent. Calls from concurrent goroutines within Wait
+// are collected and dispatched as a single query, which runs until the latest deadline of the calls
+// with values (e.g. auth.WithLoginUid) of the first call. Each call returns early when its own ctx is done.
+func (l *RelationLoader) LoadContext(ctx context.Context, parent Model) ([]QueryData, error) {
+	l.mutex.Lock()
+	batch := l.pending
+	if batch == nil {
+		batch = &loaderBatch{
+			ctx:  ctx,
+			done: make(chan struct{}),
+		}
+		l.pending = batch
+		time.AfterFunc(l.Wait, func() { l.dispatch(batch) })
+	}
+	batch.parents = append(batch.parents, parent)
+	if deadline, ok := ctx.Deadline(); !ok {
+		batch.unbounded = true
+	} else if deadline.After(batch.deadline) {
+		batch.deadline = deadline
+	}
+	full := l.MaxBatch > 0 && len(batch.parents) >= l.MaxBatch
+	l.mutex.Unlock()
+
+	if full {
+		l.dispatch(batch)
+	}
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	if parent == nil || !parent.isSaved() {
+		return []QueryData{}, nil
+	}
+	return batch.results[parent.GetUid()], nil
+}
+
+func (l *RelationLoader) dispatch(batch *loaderBatch) {
+	l.mutex.Lock()
+	if l.pending != batch {
+		l.mutex.Unlock()
+		return // already dispatched
+	}
+	l.pending = nil
+	l.mutex.Unlock()
+
+	// not canceled along with any single call
+	var ctx context.Context = detachedContext{batch.ctx}
+	if !batch.unbounded {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, batch.deadline)
+		defer cancel()
+	}
+
+	batch.results, batch.err = l.LoadAllContext(ctx, batch.parents)
+	close(batch.done)
+}
+
+// detachedContext keeps values of Context, without its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package graphor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRelationLoaderContexts(t *testing.T) {
+	tests := []struct {
+		name  string
+		first func() (context.Context, context.CancelFunc)
+	}{
+		{"first call canceled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			return ctx, cancel
+		}},
+		{"first call timed out", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Millisecond)
+		}},
+	}
+
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob", "carol")
+	follows := testUserSchema().Relations["follows"]
+	err := c.Mutate(func(m *Mutation) error {
+		c.BuildRelation(users[1], follows).Add(m, users[2])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader := c.NewRelationLoader(follows)
+			loader.Wait = 50 * time.Millisecond
+
+			ctx, cancel := tt.first()
+			firstErr := make(chan error)
+			go func() {
+				_, err := loader.LoadContext(ctx, users[0])
+				firstErr <- err
+			}()
+			for {
+				loader.mutex.Lock()
+				opened := loader.pending != nil
+				loader.mutex.Unlock()
+				if opened {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+
+			children, err := loader.LoadContext(context.Background(), users[1])
+			if err != nil || len(children) != 1 {
+				t.Errorf("LoadContext() = %v, %v; want 1 child", children, err)
+			}
+			if err := <-firstErr; err == nil {
+				t.Errorf("LoadContext() of the first call = nil, want context error")
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package graphor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/nosukeru/graphor/database"
+)
+
+// predicate is a single line of dgraph schema.
+type predicate struct {
+	Name    string
+	Type    string
+	Index   []string
+	Reverse bool
+	Lang    bool
+	Count   bool
+	List    bool
+	Upsert  bool
+}
+
+func (p predicate) String() string {
+	t := p.Type
+	if p.List {
+		t = "[" + t + "]"
+	}
+
+	directives := []string{}
+	if len(p.Index) > 0 {
+		directives = append(directives, fmt.Sprintf("@index(%s)", strings.Join(p.Index, ", ")))
+	}
+	if p.Reverse {
+		directives = append(directives, "@reverse")
+	}
+	if p.Count {
+		directives = append(directives, "@count")
+	}
+	if p.Lang {
+		directives = append(directives, "@lang")
+	}
+	if p.Upsert {
+		directives = append(directives, "@upsert")
+	}
+
+	if len(directives) == 0 {
+		return fmt.Sprintf("%s: %s .", p.Name, t)
+	}
+	return fmt.Sprintf("%s: %s %s .", p.Name, t, strings.Join(directives, " "))
+}
+
+// merge adds indexes & directives of other to p, for predicates shared among schemas.
+func (p predicate) merge(other predicate) predicate {
+	if p.Type != other.Type || p.List != other.List {
+		log.Printf("BaseMigrations: Conflicting types for predicate %q (%s, %s). The former is used.", p.Name, p.Type, other.Type)
+	}
+
+	p.Index = mergeIndex(p.Index, other.Index)
+	p.Reverse = p.Reverse || other.Reverse
+	p.Lang = p.Lang || other.Lang
+	p.Count = p.Count || other.Count
+	p.Upsert = p.Upsert || other.Upsert
+	return p
+}
+
+func mergeIndex(a []string, b []string) []string {
+	set := map[string]bool{}
+	for _, tokenizer := range append(append([]string{}, a...), b...) {
+		set[tokenizer] = true
+	}
+
+	index := []string{}
+	for tokenizer := range set {
+		index = append(index, tokenizer)
+	}
+	sort.Strings(index)
+	return index
+}
+
+// uniqueTokenizers is the index added to unique fields of each type, which have no index for eq.
+var uniqueTokenizers = map[string]string{
+	"string":   "exact",
+	"int":      "int",
+	"float":    "float",
+	"bool":     "bool",
+	"datetime": "year",
+}
+
+func hasEqIndex(index []string) bool {
+	for _, tokenizer := range index {
+		for _, t := range functionIndexes["eq"] {
+			if tokenizer == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// basePredicates generates predicates for timestamps, fields and edges of schemaList.
+func basePredicates(schemaList []Schema) []predicate {
+	predicates := map[string]predicate{}
+	add := func(p predicate) {
+		if current, ok := predicates[p.Name]; ok {
+			p = current.merge(p)
+		} else {
+			p.Index = mergeIndex(p.Index, nil)
+		}
+		predicates[p.Name] = p
+	}
+
+	// Model
+	add(predicate{Name: "tag", Type: "int", Index: []string{"int"}})
+	add(predicate{Name: "created_at", Type: "int", Index: []string{"int"}})
+	add(predicate{Name: "updated_at", Type: "int", Index: []string{"int"}})
+	add(predicate{Name: "deleted_at", Type: "int"})
+
+	untyped := []string{}
+	for _, schema := range schemaList {
+		// Fields
+		for name, f := range schema.FieldSchemas {
+			add(f.predicate(name))
+		}
+
+		for _, field := range schema.Fields {
+			if name, ok := fieldPredicate(field); ok {
+				untyped = append(untyped, name)
+			}
+		}
+
+		for _, name := range schema.Unique {
+			p := schema.FieldSchemas[name].predicate(name)
+			if tokenizer, ok := uniqueTokenizers[p.Type]; ok && !hasEqIndex(p.Index) {
+				p.Index = append(append([]string{}, p.Index...), tokenizer)
+			}
+			p.Upsert = true
+			add(p)
+		}
+
+		// Edges
+		edges := []string{}
+
+		for _, b := range schema.Booleans {
+			edges = append(edges, b.Edge)
+		}
+
+		for _, r := range schema.Relations {
+			edges = append(edges, r.Edge)
+		}
+
+		for _, edge := range edges {
+			if isReversed(edge) {
+				add(predicate{Name: reverseEdge(edge), Type: "uid", Reverse: true})
+			} else {
+				add(predicate{Name: edge, Type: "uid"})
+			}
+		}
+	}
+
+	// fields listed only in Fields are strings, unless typed by any schema
+	for _, name := range untyped {
+		if _, ok := predicates[name]; !ok {
+			add(predicate{Name: name, Type: "string"})
+		}
+	}
+
+	list := []predicate{}
+	for _, p := range predicates {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// fieldPredicate returns the predicate of field listed in Schema.Fields, dropping its language tag.
+// Expressions like count(uid) and uid itself are not predicates.
+func fieldPredicate(field string) (string, bool) {
+	name := strings.SplitN(field, "@", 2)[0]
+	if name == "uid" || !fieldNamePattern.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func (g *Client) BaseMigrations(schemaList []Schema) string {
+	lines := []string{}
+	for _, p := range basePredicates(schemaList) {
+		lines = append(lines, p.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// PredicateChange is a difference between current dgraph schema and the one required by schemas.
+type PredicateChange struct {
+	Name         string
+	Current      string // schema line in database, empty if added
+	Required     string // schema line required by schemas, empty if dropped
+	AddedIndex   []string
+	DroppedIndex []string
+	Reindex      bool // whether applying the change rebuilds indexes over existing data
+}
+
+// MigrationPlan reports how current dgraph schema differs from the one required by schemas.
+type MigrationPlan struct {
+	Added   []PredicateChange // required but missing in database
+	Changed []PredicateChange // type, indexes or directives differ
+	Dropped []PredicateChange // in database but not required (may be declared by hand)
+}
+
+func (plan *MigrationPlan) IsEmpty() bool {
+	return len(plan.Added) == 0 && len(plan.Changed) == 0 && len(plan.Dropped) == 0
+}
+
+func (plan *MigrationPlan) String() string {
+	lines := []string{}
+
+	for _, c := range plan.Added {
+		lines = append(lines, "+ "+c.Required)
+	}
+
+	for _, c := range plan.Changed {
+		line := fmt.Sprintf("~ %s -> %s", c.Current, c.Required)
+		if len(c.AddedIndex) > 0 {
+			line += fmt.Sprintf(" (add index: %s)", strings.Join(c.AddedIndex, ", "))
+		}
+		if len(c.DroppedIndex) > 0 {
+			line += fmt.Sprintf(" (drop index: %s)", strings.Join(c.DroppedIndex, ", "))
+		}
+		if c.Reindex {
+			line += " [reindex]"
+		}
+		lines = append(lines, line)
+	}
+
+	for _, c := range plan.Dropped {
+		lines = append(lines, "- "+c.Current)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (g *Client) PlanMigration(schemaList []Schema) (*MigrationPlan, error) {
+	return g.PlanMigrationContext(context.Background(), schemaList)
+}
+
+// PlanMigrationContext compares current dgraph schema with BaseMigrations of schemaList, without altering anything.
+func (g *Client) PlanMigrationContext(ctx context.Context, schemaList []Schema) (*MigrationPlan, error) {
+	current, err := g.database.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return planMigration(current, basePredicates(schemaList)), nil
+}
+
+func planMigration(current []database.Predicate, required []predicate) *MigrationPlan {
+	plan := &MigrationPlan{
+		Added:   []PredicateChange{},
+		Changed: []PredicateChange{},
+		Dropped: []PredicateChange{},
+	}
+
+	existing := map[string]predicate{}
+	for _, p := range current {
+		if isInternalPredicate(p.Predicate) {
+			continue
+		}
+		existing[p.Predicate] = fromDatabasePredicate(p)
+	}
+
+	for _, req := range required {
+		cur, ok := existing[req.Name]
+		delete(existing, req.Name)
+
+		if !ok {
+			plan.Added = append(plan.Added, PredicateChange{Name: req.Name, Required: req.String(), AddedIndex: req.Index})
+			continue
+		}
+
+		if cur.String() == req.String() {
+			continue
+		}
+
+		added := subtractIndex(req.Index, cur.Index)
+		dropped := subtractIndex(cur.Index, req.Index)
+
+		plan.Changed = append(plan.Changed, PredicateChange{
+			Name:         req.Name,
+			Current:      cur.String(),
+			Required:     req.String(),
+			AddedIndex:   added,
+			DroppedIndex: dropped,
+			Reindex:      len(added) > 0 || len(dropped) > 0 || cur.Type != req.Type || cur.Reverse != req.Reverse || cur.Count != req.Count,
+		})
+	}
+
+	names := []string{}
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cur := existing[name]
+		plan.Dropped = append(plan.Dropped, PredicateChange{Name: name, Current: cur.String(), DroppedIndex: cur.Index, Reindex: len(cur.Index) > 0})
+	}
+
+	return plan
+}
+
+func fromDatabasePredicate(p database.Predicate) predicate {
+	return predicate{
+		Name:    p.Predicate,
+		Type:    p.Type,
+		Index:   mergeIndex(p.Tokenizer, nil),
+		Reverse: p.Reverse,
+		Lang:    p.Lang,
+		Count:   p.Count,
+		List:    p.List && p.Type != "uid", // uid edges are always lists
+		Upsert:  p.Upsert,
+	}
+}
+
+// isInternalPredicate reports predicates managed by dgraph itself, or by graphor to record migration history.
+func isInternalPredicate(name string) bool {
+	return name == "_predicate_" || strings.HasPrefix(name, "dgraph.") || name == migrationVersionPredicate
+}
+
+func subtractIndex(a []string, b []string) []string {
+	set := map[string]bool{}
+	for _, tokenizer := range b {
+		set[tokenizer] = true
+	}
+
+	diff := []string{}
+	for _, tokenizer := range a {
+		if !set[tokenizer] {
+			diff = append(diff, tokenizer)
+		}
+	}
+	return diff
+}
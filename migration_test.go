@@ -0,0 +1,102 @@
+package graphor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBaseMigrationsUnique(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    FieldSchema
+		declared bool
+		want     string
+	}{
+		{"undeclared", FieldSchema{}, false, "code: string @index(exact) @upsert ."},
+		{"string", FieldSchema{Type: "string", Index: []string{"trigram"}}, true, "code: string @index(exact, trigram) @upsert ."},
+		{"string with hash", FieldSchema{Type: "string", Index: []string{"hash"}}, true, "code: string @index(hash) @upsert ."},
+		{"int", FieldSchema{Type: "int", Index: []string{"int"}}, true, "code: int @index(int) @upsert ."},
+		{"int without index", FieldSchema{Type: "int"}, true, "code: int @index(int) @upsert ."},
+		{"datetime", FieldSchema{Type: "datetime", Index: []string{"hour"}}, true, "code: datetime @index(hour) @upsert ."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := Schema{Tag: 1, FieldSchemas: map[string]FieldSchema{}, Unique: []string{"code"}}
+			if tt.declared {
+				schema.FieldSchemas["code"] = tt.field
+			}
+
+			body := BaseMigrations([]Schema{schema})
+			if !strings.Contains(body, tt.want+"\n") {
+				t.Errorf("BaseMigrations() = %s, want line %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanMigrationIgnoresHistory(t *testing.T) {
+	c := newTestClient()
+	schemaList := []Schema{testUserSchema()}
+
+	if err := c.MigrateDatabase(BaseMigrations(schemaList)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.prepareMigrationHistory(); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := c.PlanMigration(schemaList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.IsEmpty() {
+		t.Errorf("PlanMigration() = %s, want empty plan", plan)
+	}
+}
+
+func TestBaseMigrationsFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema Schema
+		want   string
+		absent string
+	}{
+		{"untyped", Schema{Tag: 1, Fields: []string{"title"}}, "title: string .", ""},
+		{"language tag", Schema{Tag: 1, Fields: []string{"title@en"}}, "title: string .", "title@en"},
+		{"typed elsewhere", Schema{Tag: 1, Fields: []string{"age"}, FieldSchemas: map[string]FieldSchema{"age": {Type: "int"}}}, "age: int .", "age: string ."},
+		{"expression", CountSchema(1), "tag: int @index(int) .", "count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := BaseMigrations([]Schema{tt.schema}) + "\n"
+			if !strings.Contains(body, tt.want+"\n") {
+				t.Errorf("BaseMigrations() = %s, want line %q", body, tt.want)
+			}
+			if tt.absent != "" && strings.Contains(body, tt.absent) {
+				t.Errorf("BaseMigrations() = %s, want no %q", body, tt.absent)
+			}
+		})
+	}
+}
+
+func TestPlanMigrationKeepsFields(t *testing.T) {
+	c := newTestClient()
+	schemaList := []Schema{{Tag: 3, Fields: []string{"title"}}}
+
+	if err := c.MigrateDatabase(BaseMigrations(schemaList)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MigrateDatabase("title: string ."); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := c.PlanMigration(schemaList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.IsEmpty() {
+		t.Errorf("PlanMigration() = %s, want empty plan", plan)
+	}
+}
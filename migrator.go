@@ -0,0 +1,258 @@
+package graphor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+// Migration is a versioned step of schema (or data) changes. Versions are applied in lexical order,
+// so use sortable ids such as "20190601_add_user_email".
+type Migration struct {
+	Version string
+	Schema  string                                     // dgraph schema fragment altered before Up (optional)
+	Up      func(ctx context.Context, c *Client) error // optional
+	Down    func(ctx context.Context, c *Client) error // reverts Schema & Up; required to roll back
+}
+
+var (
+	migrations      = map[string]Migration{}
+	migrationsMutex sync.RWMutex
+)
+
+// RegisterMigration registers m to be run by Migrate. It panics if the version is registered twice.
+func RegisterMigration(m Migration) {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+
+	if _, ok := migrations[m.Version]; ok {
+		panic(fmt.Sprintf("graphor: Migration %q registered twice.", m.Version))
+	}
+	migrations[m.Version] = m
+}
+
+func registeredVersions() []string {
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+
+	versions := []string{}
+	for version := range migrations {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+func registeredMigration(version string) (Migration, bool) {
+	migrationsMutex.RLock()
+	defer migrationsMutex.RUnlock()
+
+	m, ok := migrations[version]
+	return m, ok
+}
+
+// migrationRecord is a node recording an applied migration.
+type migrationRecord struct {
+	ModelProperty
+	Version string `json:"graphor_migration_version"`
+}
+
+const (
+	migrationTag              = -1
+	migrationVersionPredicate = "graphor_migration_version"
+)
+
+func migrationSchema() Schema {
+	return Schema{
+		Tag:    migrationTag,
+		Fields: []string{migrationVersionPredicate},
+		Unique: []string{migrationVersionPredicate},
+	}
+}
+
+// prepareMigrationHistory declares predicates needed to record migration history.
+func (g *Client) prepareMigrationHistory() error {
+	return g.MigrateDatabase(`
+		tag: int @index(int) .
+		` + migrationVersionPredicate + `: string @index(exact) @upsert .
+	`)
+}
+
+func (g *Client) appliedMigrations(ctx context.Context) (map[string]*migrationRecord, error) {
+	dataList, err := g.BuildQuery(migrationSchema()).SetSortOption(migrationVersionPredicate, "asc").AllContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := map[string]*migrationRecord{}
+	for _, data := range dataList {
+		record := new(migrationRecord)
+		Init(record, data)
+		records[record.Version] = record
+	}
+	return records, nil
+}
+
+func (g *Client) AppliedMigrations() ([]string, error) {
+	return g.AppliedMigrationsContext(context.Background())
+}
+
+// AppliedMigrationsContext returns versions of migrations applied to the database in order.
+func (g *Client) AppliedMigrationsContext(ctx context.Context) ([]string, error) {
+	err := g.prepareMigrationHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := g.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for version := range records {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+func (g *Client) Migrate(up bool) error {
+	return g.MigrateContext(context.Background(), up)
+}
+
+// MigrateContext applies all pending migrations if up, or rolls back the latest applied one otherwise.
+func (g *Client) MigrateContext(ctx context.Context, up bool) error {
+	if up {
+		versions := registeredVersions()
+		if len(versions) == 0 {
+			return nil
+		}
+		return g.MigrateToContext(ctx, versions[len(versions)-1])
+	}
+
+	err := g.prepareMigrationHistory()
+	if err != nil {
+		return err
+	}
+
+	records, err := g.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := ""
+	for version := range records {
+		if version > latest {
+			latest = version
+		}
+	}
+
+	if latest == "" {
+		return nil
+	}
+	return g.rollback(ctx, latest, records[latest])
+}
+
+func (g *Client) MigrateTo(version string) error {
+	return g.MigrateToContext(context.Background(), version)
+}
+
+// MigrateToContext applies registered migrations up to version, and rolls back applied ones after it.
+// Empty version rolls back everything.
+func (g *Client) MigrateToContext(ctx context.Context, version string) error {
+	if _, ok := registeredMigration(version); version != "" && !ok {
+		return errors.New(errors.MigrationNotFound, "Migrate failed: Version not registered.").Add("version", version)
+	}
+
+	err := g.prepareMigrationHistory()
+	if err != nil {
+		return err
+	}
+
+	return g.migrateTo(ctx, version)
+}
+
+func (g *Client) migrateTo(ctx context.Context, target string) error {
+	records, err := g.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	// roll back newer ones first
+	applied := []string{}
+	for version := range records {
+		applied = append(applied, version)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(applied)))
+
+	for _, version := range applied {
+		if target != "" && version <= target {
+			break
+		}
+
+		err := g.rollback(ctx, version, records[version])
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, version := range registeredVersions() {
+		if target == "" || version > target {
+			break
+		}
+
+		if _, ok := records[version]; ok {
+			continue
+		}
+
+		err := g.apply(ctx, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Client) apply(ctx context.Context, version string) error {
+	m, _ := registeredMigration(version)
+
+	if m.Schema != "" {
+		err := g.MigrateDatabase(m.Schema)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Up != nil {
+		err := m.Up(ctx, g)
+		if err != nil {
+			return errors.New(errors.MigrationFailed, err.Error()).Add("version", version)
+		}
+	}
+
+	return g.TransactionContext(ctx, func(tx *Tx) error {
+		return tx.Save(&migrationRecord{Version: version}, migrationSchema())
+	})
+}
+
+func (g *Client) rollback(ctx context.Context, version string, record *migrationRecord) error {
+	m, ok := registeredMigration(version)
+	if !ok || m.Down == nil {
+		return errors.New(errors.IrreversibleMigration, "Migrate failed: Can't roll back migration without Down.").Add("version", version)
+	}
+
+	err := m.Down(ctx, g)
+	if err != nil {
+		return errors.New(errors.MigrationFailed, err.Error()).Add("version", version)
+	}
+
+	return g.MutateContext(ctx, func(m *Mutation) error {
+		m.HardDelete(record)
+		return nil
+	})
+}
@@ -0,0 +1,216 @@
+package graphor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nosukeru/graphor/database"
+	"github.com/nosukeru/graphor/errors"
+	"github.com/nosukeru/graphor/timestamp"
+)
+
+// Mutator is a write buffer accepted by Relation mutations; either *Mutation or *Tx.
+type Mutator interface {
+	mutation() *Mutation
+}
+
+// Mutation buffers writes made inside a single Mutate call.
+type Mutation struct {
+	Client     *Client
+	ctx        context.Context
+	tx         *Tx
+	buffer     *database.Mutation
+	created    []Model
+	touched    []modelState      // models before changed by this mutation, restored if it fails
+	uniques    map[string]string // unique value key -> uid of the model saved with it
+	indexCount int
+}
+
+// modelState is the metadata of a model which mutations set.
+type modelState struct {
+	model                           Model
+	uid                             string
+	createdAt, updatedAt, deletedAt int
+}
+
+func newMutation(ctx context.Context, client *Client) *Mutation {
+	return &Mutation{
+		Client:  client,
+		ctx:     ctx,
+		buffer:  database.NewMutation(),
+		created: []Model{},
+		uniques: map[string]string{},
+	}
+}
+
+func (m *Mutation) mutation() *Mutation {
+	return m
+}
+
+func (m *Mutation) index() int {
+	m.indexCount++
+	return m.indexCount
+}
+
+// buildQuery builds a query which runs in the same transaction as the mutation if any.
+func (m *Mutation) buildQuery(schema Schema) Query {
+	if m.tx != nil {
+		return m.tx.BuildQuery(schema)
+	}
+	return m.Client.BuildQuery(schema)
+}
+
+// Save buffers insertion of model. It fails with errors.UniqueViolation if another record
+// (stored, or saved in this mutation) has the same value for one of schema.Unique fields.
+func (m *Mutation) Save(model Model, schema Schema) error {
+	if model == nil {
+		return nil
+	}
+
+	err := m.checkUnique(model, schema)
+	if err != nil {
+		return err
+	}
+
+	m.touch(model)
+
+	if model.isEmpty() {
+		model.SetUid(fmt.Sprintf("_:model%d", m.index()))
+		m.created = append(m.created, model)
+		model.setCreatedAt(timestamp.Now())
+	}
+
+	model.setUpdatedAt(timestamp.Now())
+
+	all := toMap(model)
+
+	// omit non-fields
+	partial := map[string]interface{}{}
+	fields := schema.fields()
+
+	for _, field := range fields {
+		if v, ok := all[field]; ok {
+			partial[field] = v
+		}
+	}
+	partial["uid"] = model.GetUid()
+	partial["tag"] = schema.Tag
+	partial["updated_at"] = model.GetUpdatedAt()
+
+	if model.GetCreatedAt() > 0 {
+		partial["created_at"] = model.GetCreatedAt()
+	}
+
+	if model.GetDeletedAt() > 0 {
+		partial["deleted_at"] = model.GetDeletedAt()
+	}
+
+	q := toJSON(partial)
+	m.buffer.Insert(q)
+
+	for _, field := range schema.Unique {
+		if v, ok := partial[field]; ok && !isEmpty(v) {
+			m.uniques[uniqueKey(schema.Tag, field, v)] = model.GetUid()
+		}
+	}
+
+	return nil
+}
+
+func (m *Mutation) checkUnique(model Model, schema Schema) error {
+	if len(schema.Unique) == 0 {
+		return nil
+	}
+
+	all := toMap(model)
+
+	for _, field := range schema.Unique {
+		value, ok := all[field]
+		if !ok || isEmpty(value) {
+			continue
+		}
+		value = normalizeNumber(value)
+
+		violation := errors.New(errors.UniqueViolation, "Save failed: Duplicate value for unique field.").Add("field", field).Add("value", toJSON(value))
+
+		if uid, ok := m.uniques[uniqueKey(schema.Tag, field, value)]; ok && uid != model.GetUid() {
+			return violation
+		}
+
+		dataList, err := m.buildQuery(schema).Where(field, "eq", value).Take(2).AllContext(m.ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, data := range dataList {
+			if decodeString(data["uid"]) != model.GetUid() {
+				return violation
+			}
+		}
+	}
+
+	return nil
+}
+
+func uniqueKey(tag int, field string, value interface{}) string {
+	return fmt.Sprintf("%d|%s|%s", tag, field, toJSON(value))
+}
+
+func (m *Mutation) Delete(model Model) {
+	if model == nil {
+		return
+	}
+
+	m.touch(model)
+	model.setDeletedAt(timestamp.Now())
+
+	partial := map[string]interface{}{
+		"uid":        model.GetUid(),
+		"deleted_at": model.GetDeletedAt(),
+	}
+
+	q := toJSON(partial)
+	m.buffer.Insert(q)
+}
+
+func (m *Mutation) HardDelete(model Model) {
+	if model == nil || !model.isSaved() {
+		return
+	}
+
+	q := fmt.Sprintf(`{"uid": %q}`, model.GetUid())
+	m.buffer.Delete(q)
+}
+
+// assignUids replaces blank node uids of created models with uids assigned by dgraph.
+func (m *Mutation) assignUids(uids map[string]string) error {
+	for _, model := range m.created {
+		if model.isNew() {
+			uid, ok := uids[model.GetUid()[2:]]
+			if !ok {
+				return errors.New(errors.NoUidReturned, "Mutate failed: No uid returned.")
+			}
+
+			model.SetUid(uid)
+		}
+	}
+
+	return nil
+}
+
+// touch records metadata of model before it's changed by this mutation.
+func (m *Mutation) touch(model Model) {
+	m.touched = append(m.touched, modelState{model, model.GetUid(), model.GetCreatedAt(), model.GetUpdatedAt(), model.GetDeletedAt()})
+}
+
+// restoreModels puts uids and timestamps of models back to before a failed transaction,
+// so that retries start from the same models.
+func (m *Mutation) restoreModels() {
+	for i := len(m.touched) - 1; i >= 0; i-- {
+		state := m.touched[i]
+		state.model.SetUid(state.uid)
+		state.model.setCreatedAt(state.createdAt)
+		state.model.setUpdatedAt(state.updatedAt)
+		state.model.setDeletedAt(state.deletedAt)
+	}
+}
@@ -0,0 +1,148 @@
+package graphor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func TestMutationSave(t *testing.T) {
+	c := newTestClient()
+	schema := testUserSchema()
+	schema.Unique = []string{"name"}
+
+	user := &testUser{Name: "alice", Age: 20}
+	err := c.Mutate(func(m *Mutation) error {
+		return m.Save(user, schema)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isValidUid(user.GetUid()) || user.GetCreatedAt() == 0 {
+		t.Fatalf("Save() = uid %q, created_at %d", user.GetUid(), user.GetCreatedAt())
+	}
+
+	user.Age = 21
+	err = c.Mutate(func(m *Mutation) error {
+		return m.Save(user, schema)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindOne[*testUser](c.BuildQuery(schema).Identify(user.GetUid()))
+	if err != nil || found == nil || found.Age != 21 {
+		t.Errorf("FindOne() = %+v, %v; want age 21", found, err)
+	}
+
+	err = c.Mutate(func(m *Mutation) error {
+		return m.Save(&testUser{Name: "alice"}, schema)
+	})
+	if !errors.HasCode(err, errors.UniqueViolation) {
+		t.Errorf("Save() of duplicate = %v, want UniqueViolation", err)
+	}
+
+	err = c.Mutate(func(m *Mutation) error {
+		m.Delete(user)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := c.BuildQuery(schema).Count()
+	if err != nil || count != 0 {
+		t.Errorf("Count() after Delete = %d, %v; want 0", count, err)
+	}
+}
+
+func TestMutationRelations(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob", "carol")
+	follows := testUserSchema().Relations["follows"]
+
+	tests := []struct {
+		name   string
+		mutate func(m *Mutation, r Relation)
+		want   []string
+	}{
+		{"add", func(m *Mutation, r Relation) { r.Add(m, users[1]); r.Add(m, users[2]) }, []string{"bob", "carol"}},
+		{"remove", func(m *Mutation, r Relation) { r.Remove(m, users[1]) }, []string{"carol"}},
+		{"clear", func(m *Mutation, r Relation) { r.Clear(m) }, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Mutate(func(m *Mutation) error {
+				tt.mutate(m, c.BuildRelation(users[0], follows))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found, err := Find[*testUser](c.BuildRelation(users[0], follows).SetSortOption("name", "asc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, user := range found {
+				names = append(names, user.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("Find() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutationConcurrentUniqueSaves(t *testing.T) {
+	c := newTestClient()
+	schema := testUserSchema()
+	schema.Unique = []string{"name"}
+	if err := c.DB().Migrate(c.BaseMigrations([]Schema{schema})); err != nil {
+		t.Fatal(err)
+	}
+
+	save := func() error {
+		return c.Mutate(func(m *Mutation) error {
+			return m.Save(&testUser{Name: "alice"}, schema)
+		})
+	}
+
+	// the other save commits between the unique check and the commit of the first one
+	var other error
+	err := c.Mutate(func(m *Mutation) error {
+		if err := m.Save(&testUser{Name: "alice"}, schema); err != nil {
+			return err
+		}
+		other = save()
+		return nil
+	})
+	if other != nil || !errors.HasCode(err, errors.TxnAborted) {
+		t.Errorf("Mutate() = %v, other = %v; want TxnAborted, nil", err, other)
+	}
+
+	// saves racing in goroutines
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = save()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !errors.HasCode(err, errors.TxnAborted) && !errors.HasCode(err, errors.UniqueViolation) {
+			t.Errorf("Mutate() = %v, want TxnAborted or UniqueViolation", err)
+		}
+	}
+
+	count, err := c.BuildQuery(schema).Count()
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v; want 1", count, err)
+	}
+}
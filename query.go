@@ -1,8 +1,15 @@
 package graphor
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"regexp"
 	"strings"
+
+	"github.com/nosukeru/graphor/auth"
+	"github.com/nosukeru/graphor/errors"
 )
 
 type QueryData map[string]interface{}
@@ -18,32 +25,54 @@ type Query interface {
 	HasNot(edge string) Query
 	Or(filters ...(func(q Query) Query)) Query
 	Regex(field, regex string) Query
+	Search(field string, text string) Query
+	SearchAll(field string, text string) Query
+	Fuzzy(field string, value string, distance int) Query
+	RegexCI(field string, pattern string) Query
+	Near(field string, point GeoPoint, meters float64) Query
+	Within(field string, polygon Polygon) Query
+	Filter(expr Expr) Query
 	Scope(filter func(q Query) Query) Query
+	With(name string, scopes ...func(q Query) Query) Query
 	Identify(uids ...string) Query
+	As(loginUid string) Query
 	Debug() Query
 	Execute() ([]interface{}, error)
+	ExecuteContext(ctx context.Context) ([]interface{}, error)
 	First() (QueryData, error)
+	FirstContext(ctx context.Context) (QueryData, error)
 	All() ([]QueryData, error)
+	AllContext(ctx context.Context) ([]QueryData, error)
 	Get(interface{}) error
+	GetContext(ctx context.Context, x interface{}) error
 	Paging(since interface{}, until interface{}, count int) Query
 	Exists() (bool, error)
+	ExistsContext(ctx context.Context) (bool, error)
 	Count() (int, error)
+	CountContext(ctx context.Context) (int, error)
 }
 
 type query struct {
+	Client         *Client
+	Tx             *Tx
 	Base           string
 	Args           map[string]interface{}
 	Filters        []string
 	SortKey        string
 	SortOrder      string
 	TakeCount      int
+	After          string // uid to page after in uid order, instead of sorting
 	OnlyNotDeleted bool
+	LoginUid       string
 	IsDebug        bool
 	Schema         Schema
+	Vars           *variables // values of filters, shared with sub queries (Or, With)
+	Err            error      // first invalid input, returned by Execute
 }
 
-func build(qStr string, schema Schema, args map[string]interface{}) *query {
+func build(client *Client, qStr string, schema Schema, args map[string]interface{}) *query {
 	q := new(query)
+	q.Client = client
 	q.Base = qStr
 	q.Args = args
 	q.Filters = []string{}
@@ -51,23 +80,11 @@ func build(qStr string, schema Schema, args map[string]interface{}) *query {
 	q.SortOrder = "desc"
 	q.TakeCount = 0
 	q.Schema = schema
+	q.Vars = newVariables()
 
 	return q
 }
 
-func BuildRawQuery(qStr string, schema Schema, args map[string]interface{}) Query {
-	return build(qStr, schema, args)
-}
-
-func BuildQuery(schema Schema) Query {
-	qAll := `
-	{
-		q(func: eq(tag, #{tag}), #{sorting}#{take}) #{filter} { #{body} }
-	}`
-
-	return build(qAll, schema, map[string]interface{}{})
-}
-
 func (q *query) SetSortOption(key string, order string) Query {
 	q.SortKey = key
 	q.SortOrder = order
@@ -87,8 +104,25 @@ func (q *query) Take(count int) Query {
 	return q
 }
 
+// fail records err to be returned by Execute. Only the first error is kept.
+func (q *query) fail(err error) Query {
+	if q.Err == nil {
+		q.Err = err
+	}
+	return q
+}
+
 func (q *query) Where(field string, op string, value interface{}) Query {
-	q.Filters = append(q.Filters, fmt.Sprintf("%s(%s, %s)", op, field, eval(value)))
+	if !isSafeToken(field) || !isSafeToken(op) {
+		return q.fail(invalidQuery("Where", "field", field).Add("op", op))
+	}
+
+	name, err := q.Vars.add(value)
+	if err != nil {
+		return q.fail(err)
+	}
+
+	q.Filters = append(q.Filters, fmt.Sprintf("%s(%s, %s)", op, field, name))
 	return q
 }
 
@@ -97,11 +131,19 @@ func (q *query) Between(field string, left interface{}, right interface{}) Query
 }
 
 func (q *query) Has(edge string) Query {
+	if !isSafeToken(edge) {
+		return q.fail(invalidQuery("Has", "edge", edge))
+	}
+
 	q.Filters = append(q.Filters, fmt.Sprintf("has(%s)", edge))
 	return q
 }
 
 func (q *query) HasNot(edge string) Query {
+	if !isSafeToken(edge) {
+		return q.fail(invalidQuery("HasNot", "edge", edge))
+	}
+
 	q.Filters = append(q.Filters, fmt.Sprintf("not has(%s)", edge))
 	return q
 }
@@ -112,8 +154,13 @@ func (q *query) Or(filters ...(func(q Query) Query)) Query {
 	for _, filter := range filters {
 		qf := filter(&query{
 			Filters: []string{},
+			Schema:  q.Schema,
+			Vars:    q.Vars,
 		}).(*query)
 
+		if qf.Err != nil {
+			return q.fail(qf.Err)
+		}
 		conditions = append(conditions, "("+strings.Join(qf.Filters, " and ")+")")
 	}
 
@@ -121,8 +168,84 @@ func (q *query) Or(filters ...(func(q Query) Query)) Query {
 	return q
 }
 
+// Regex filters by regex in the form of "/pattern/flags" (e.g. "/^alice/i").
 func (q *query) Regex(field, regex string) Query {
-	q.Filters = append(q.Filters, fmt.Sprintf("regexp(%s, %s)", field, regex))
+	if !isSafeToken(field) {
+		return q.fail(invalidQuery("Regex", "field", field))
+	}
+	if !isValidRegex(regex) {
+		return q.fail(invalidQuery("Regex", "regex", regex))
+	}
+
+	name, _ := q.Vars.add(regex) // strings are always supported
+	q.Filters = append(q.Filters, fmt.Sprintf("regexp(%s, %s)", field, name))
+	return q
+}
+
+// Search matches field having any of words in text, by full-text search if field has fulltext index,
+// or by terms if it has term index.
+func (q *query) Search(field string, text string) Query {
+	return q.search("Search", "any", field, text)
+}
+
+// SearchAll is Search matching field having all of words in text.
+func (q *query) SearchAll(field string, text string) Query {
+	return q.search("SearchAll", "all", field, text)
+}
+
+func (q *query) search(method string, quantifier string, field string, text string) Query {
+	index, err := q.Schema.indexOf(method, field, "fulltext", "term")
+	if err != nil {
+		return q.fail(err)
+	}
+
+	if index == "fulltext" {
+		return q.Filter(funcExpr{quantifier + "oftext", field, []interface{}{text}})
+	}
+	return q.Filter(funcExpr{quantifier + "ofterms", field, []interface{}{text}})
+}
+
+// Fuzzy matches field within Levenshtein distance from value. field must have trigram index.
+func (q *query) Fuzzy(field string, value string, distance int) Query {
+	if _, err := q.Schema.indexOf("Fuzzy", field, "trigram"); err != nil {
+		return q.fail(err)
+	}
+
+	return q.Filter(Match(field, value, distance))
+}
+
+// RegexCI filters by case-insensitive regular expression pattern without slashes (e.g. "^ali").
+// field must have trigram index.
+func (q *query) RegexCI(field string, pattern string) Query {
+	if _, err := q.Schema.indexOf("RegexCI", field, "trigram"); err != nil {
+		return q.fail(err)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return q.fail(invalidQuery("RegexCI", "pattern", pattern))
+	}
+
+	return q.Regex(field, "/"+strings.Replace(pattern, "/", `\/`, -1)+"/i")
+}
+
+// Near filters by geo field within meters from point.
+func (q *query) Near(field string, point GeoPoint, meters float64) Query {
+	return q.Filter(Near(field, point, meters))
+}
+
+// Within filters by geo field inside polygon.
+func (q *query) Within(field string, polygon Polygon) Query {
+	return q.Filter(Within(field, polygon))
+}
+
+// Filter adds expr built by Eq, AnyOfTerms, Not, And, ... (e.g. Or(Eq("id", id), Not(Lt("age", 20)))).
+// Functions are checked against indexes declared in FieldSchemas.
+func (q *query) Filter(expr Expr) Query {
+	filter, err := expr.compile(q.Schema, q.Vars)
+	if err != nil {
+		return q.fail(err)
+	}
+
+	q.Filters = append(q.Filters, filter)
 	return q
 }
 
@@ -130,45 +253,170 @@ func (q *query) Scope(filter func(q Query) Query) Query {
 	return filter(q)
 }
 
+// With includes relation name of the schema into results of this query only,
+// filtered, sorted and limited by scopes (e.g. Where, SetSortOption, Take).
+// Nested relations can be included by dotted path (e.g. "follows.icon"), where scopes apply to the last one.
+func (q *query) With(name string, scopes ...func(q Query) Query) Query {
+	schema, err := q.Schema.with(name, q.Vars, scopes...)
+	if err != nil {
+		return q.fail(err)
+	}
+
+	q.Schema = schema
+	return q
+}
+
 func (q *query) Identify(uids ...string) Query {
 	if len(uids) == 0 || !isValidUid(uids...) {
 		uids = []string{"0x0"} // dummy uid
 	}
 
-	q.Filters = append(q.Filters, fmt.Sprintf("uid(<%s>)", strings.Join(uids, ">, <")))
+	name, _ := q.Vars.add(uidList(uids))
+	q.Filters = append(q.Filters, fmt.Sprintf("uid(%s)", name))
+	return q
+}
+
+// As evaluates booleans of this query against loginUid,
+// instead of context value (auth.WithLoginUid) or Client.Auth().
+func (q *query) As(loginUid string) Query {
+	q.LoginUid = loginUid
 	return q
 }
 
+// context returns the transaction's context for queries built by Tx.
+func (q *query) context() context.Context {
+	if q.Tx != nil {
+		return q.Tx.ctx
+	}
+	return context.Background()
+}
+
+func (q *query) loginUid(ctx context.Context) string {
+	if q.LoginUid != "" {
+		return q.LoginUid
+	}
+
+	if uid, ok := auth.LoginUidFromContext(ctx); ok {
+		return uid
+	}
+
+	return q.Client.Auth().GetLoginUid()
+}
+
+// Debug prints the query text with declarations of variables, but not their values.
 func (q *query) Debug() Query {
 	q.IsDebug = true
 	return q
 }
 
-func (q *query) generate() string {
+// generate fills args into the base query. Args quoted in the base query (e.g. "#{name}")
+// and values other than Raw, int, bool, uids and predicate names are passed as variables.
+func (q *query) generate() (string, map[string]string, error) {
 	query := q.Base
+	vars := q.Vars.clone()
+
 	for name, value := range q.Args {
-		// eval
+		placeholder := fmt.Sprintf("#{%s}", name)
+		if quoted := `"` + placeholder + `"`; strings.Contains(query, quoted) {
+			s, err := vars.add(value)
+			if err != nil {
+				return "", nil, err
+			}
+			query = strings.Replace(query, quoted, s, -1)
+		}
+
+		if !strings.Contains(query, placeholder) {
+			continue
+		}
+
 		s := ""
 		switch v := value.(type) {
+		case Raw:
+			s = string(v)
 		case int:
 			s = fmt.Sprintf("%d", v)
 		case bool:
 			s = fmt.Sprintf("%t", v)
 		case string:
+			if !isSafeToken(v) {
+				msg := "BuildRawQuery failed: Invalid arg. Wrap query syntax in Raw, or quote the placeholder to pass a value."
+				return "", nil, errors.New(errors.InvalidQuery, msg).Add("arg", v).Add("name", name)
+			}
 			s = v
+		default:
+			var err error
+			if s, err = vars.add(v); err != nil {
+				return "", nil, err
+			}
 		}
 
-		query = strings.Replace(query, fmt.Sprintf("#{%s}", name), s, -1)
+		query = strings.Replace(query, placeholder, s, -1)
 	}
 
+	query = vars.declare(query)
 	if q.IsDebug {
-		print(query)
+		log.Print(query) // values of variables may hold user data
 	}
 
-	return query
+	return query, vars.Values, nil
 }
 
 func (q *query) Execute() ([]interface{}, error) {
+	return q.ExecuteContext(q.context())
+}
+
+func (q *query) ExecuteContext(ctx context.Context) ([]interface{}, error) {
+	qStr, vars, err := q.text(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Tx != nil {
+		return q.Tx.query(ctx, qStr, vars)
+	}
+	return q.Client.DB().Query(ctx, qStr, vars)
+}
+
+// executeJSON runs the query like ExecuteContext, returning raw JSON of resulting nodes.
+func (q *query) executeJSON(ctx context.Context) ([]json.RawMessage, error) {
+	qStr, vars, err := q.text(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if q.Tx != nil {
+		body, err = q.Tx.queryJSON(ctx, qStr, vars)
+	} else {
+		body, err = q.Client.DB().QueryJSON(ctx, qStr, vars)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := struct {
+		Q []json.RawMessage `json:"q"`
+	}{}
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return nil, errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(body))
+	}
+
+	return res.Q, nil
+}
+
+// text fills args of the base query and returns the query to execute with its variables.
+func (q *query) text(ctx context.Context) (string, map[string]string, error) {
+	if q.Err != nil {
+		return "", nil, q.Err
+	}
+	if !isSafeToken(q.SortKey) || (q.SortOrder != "asc" && q.SortOrder != "desc") {
+		return "", nil, invalidQuery("SetSortOption", "key", q.SortKey).Add("order", q.SortOrder)
+	}
+	if q.After != "" && !isValidUid(q.After) {
+		return "", nil, invalidQuery("Query", "after", q.After)
+	}
+
 	filters := append(q.Filters, "not has(deleted_at)")
 	filter := fmt.Sprintf("@filter(%s)", strings.Join(filters, " and "))
 
@@ -176,24 +424,32 @@ func (q *query) Execute() ([]interface{}, error) {
 	args["tag"] = q.Schema.Tag
 
 	if !keyExists(args, "sorting") {
-		args["sorting"] = fmt.Sprintf("order%s: %s", q.SortOrder, q.SortKey)
+		if q.After != "" {
+			args["sorting"] = Raw(fmt.Sprintf("after: %s", q.After))
+		} else {
+			args["sorting"] = Raw(fmt.Sprintf("order%s: %s", q.SortOrder, q.SortKey))
+		}
 	}
 
 	if !keyExists(args, "take") {
 		if q.TakeCount > 0 {
-			args["take"] = fmt.Sprintf(", first: %d", q.TakeCount)
+			args["take"] = Raw(fmt.Sprintf(", first: %d", q.TakeCount))
 		} else {
-			args["take"] = ""
+			args["take"] = Raw("")
 		}
 	}
-	args["filter"] = filter
-	args["body"] = q.Schema.Build()
+	args["filter"] = Raw(filter)
+	args["body"] = Raw(q.Schema.build(q.loginUid(ctx)))
 
-	return db().Query(q.generate())
+	return q.generate()
 }
 
 func (q *query) First() (QueryData, error) {
-	res, err := q.Take(1).Execute()
+	return q.FirstContext(q.context())
+}
+
+func (q *query) FirstContext(ctx context.Context) (QueryData, error) {
+	res, err := q.Take(1).ExecuteContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +462,11 @@ func (q *query) First() (QueryData, error) {
 }
 
 func (q *query) All() ([]QueryData, error) {
-	res, err := q.Execute()
+	return q.AllContext(q.context())
+}
+
+func (q *query) AllContext(ctx context.Context) ([]QueryData, error) {
+	res, err := q.ExecuteContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -220,7 +480,11 @@ func (q *query) All() ([]QueryData, error) {
 }
 
 func (q *query) Get(x interface{}) error {
-	body, err := q.Execute()
+	return q.GetContext(q.context(), x)
+}
+
+func (q *query) GetContext(ctx context.Context, x interface{}) error {
+	body, err := q.ExecuteContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -252,11 +516,19 @@ func (q *query) Paging(since interface{}, until interface{}, count int) Query {
 }
 
 func (q *query) Exists() (bool, error) {
-	data, err := q.Take(1).All()
+	return q.ExistsContext(q.context())
+}
+
+func (q *query) ExistsContext(ctx context.Context) (bool, error) {
+	data, err := q.Take(1).AllContext(ctx)
 	return len(data) > 0, err
 }
 
 func (q *query) Count() (int, error) {
+	return q.CountContext(q.context())
+}
+
+func (q *query) CountContext(ctx context.Context) (int, error) {
 	q.Schema = CountSchema(q.Schema.Tag)
 
 	type Data struct {
@@ -264,7 +536,7 @@ func (q *query) Count() (int, error) {
 	}
 
 	data := []Data{}
-	err := q.Get(&data)
+	err := q.GetContext(ctx, &data)
 	if err != nil {
 		return 0, err
 	}
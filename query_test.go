@@ -0,0 +1,173 @@
+package graphor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func TestQueryWith(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob", "carol", "dave")
+	follows := testUserSchema().Relations["follows"]
+
+	err := c.Mutate(func(m *Mutation) error {
+		for _, child := range users[1:] {
+			c.BuildRelation(users[0], follows).Add(m, child)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		scope func(q Query) Query
+		want  []string
+	}{
+		{"all", func(q Query) Query { return q.SetSortOption("name", "asc") }, []string{"bob", "carol", "dave"}},
+		{"filtered", func(q Query) Query { return q.Where("age", "ge", 22).SetSortOption("age", "desc") }, []string{"dave", "carol"}},
+		{"limited", func(q Query) Query { return q.SetSortOption("name", "asc").Take(1) }, []string{"bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := FindOne[*testUser](c.BuildQuery(testUserSchema()).Identify(users[0].GetUid()).With("follows", tt.scope))
+			if err != nil || user == nil {
+				t.Fatalf("FindOne() = %v, %v", user, err)
+			}
+
+			names := []string{}
+			for _, child := range user.Follows {
+				names = append(names, child.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+				t.Errorf("Follows = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	user, err := FindOne[*testUser](c.BuildQuery(testUserSchema()).Identify(users[0].GetUid()))
+	if err != nil || user == nil || user.Follows != nil {
+		t.Errorf("FindOne() without With = %+v, %v; want no follows", user, err)
+	}
+}
+
+func TestRawQueryArgs(t *testing.T) {
+	c := newTestClient()
+	saveTestUsers(t, c, "alice", "bob")
+	base := `{ q(func: eq(tag, #{tag}), #{order}) #{filter} { #{body} } }`
+
+	tests := []struct {
+		name  string
+		order interface{}
+		err   bool
+	}{
+		{"raw syntax", Raw("orderdesc: name"), false},
+		{"string syntax", "orderdesc: name", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataList, err := c.BuildRawQuery(base, testUserSchema(), map[string]interface{}{"order": tt.order}).All()
+			if tt.err {
+				if !errors.HasCode(err, errors.InvalidQuery) {
+					t.Errorf("All() = %v, want InvalidQuery", err)
+				}
+				return
+			}
+			if err != nil || len(dataList) != 2 || dataList[0]["name"] != "bob" {
+				t.Errorf("All() = %v, %v; want bob first", dataList, err)
+			}
+		})
+	}
+}
+
+func TestQueryDebugHidesValues(t *testing.T) {
+	c := newTestClient()
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := c.BuildQuery(testUserSchema()).Where("name", "eq", "secret-name").Debug().All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "$v0: string") || strings.Contains(buf.String(), "secret-name") {
+		t.Errorf("Debug() printed %q, want declarations without values", buf.String())
+	}
+}
+
+func TestQueryIndexChecks(t *testing.T) {
+	c := newTestClient()
+	schema := Schema{
+		Fields:       []string{"bio"},
+		FieldSchemas: map[string]FieldSchema{"name": {Type: "string"}},
+	}
+
+	tests := []struct {
+		name  string
+		build func(q Query) Query
+		want  string
+		err   bool
+	}{
+		{"filter on undeclared field", func(q Query) Query { return q.Filter(AnyOfTerms("bio", "go")) }, "anyofterms(bio, $v0)", false},
+		{"search on undeclared field", func(q Query) Query { return q.Search("bio", "go") }, "anyoftext(bio, $v0)", false},
+		{"fuzzy on undeclared field", func(q Query) Query { return q.Fuzzy("bio", "go", 1) }, "match(bio, $v0, 1)", false},
+		{"regex on undeclared field", func(q Query) Query { return q.RegexCI("bio", "^go") }, "regexp(bio, $v0)", false},
+		{"filter without index", func(q Query) Query { return q.Filter(AnyOfTerms("name", "go")) }, "", true},
+		{"search without index", func(q Query) Query { return q.Search("name", "go") }, "", true},
+		{"fuzzy without index", func(q Query) Query { return q.Fuzzy("name", "go", 1) }, "", true},
+		{"regex without index", func(q Query) Query { return q.RegexCI("name", "^go") }, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, _, err := tt.build(c.BuildQuery(schema)).(*query).text(context.Background())
+			if tt.err {
+				if !errors.HasCode(err, errors.InvalidQuery) {
+					t.Errorf("text() = %v, want InvalidQuery", err)
+				}
+				return
+			}
+			if err != nil || !strings.Contains(text, tt.want) {
+				t.Errorf("text() = %q, %v; want it to contain %q", text, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryUnsupportedValues(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice")
+	follows := testUserSchema().Relations["follows"]
+	base := `{ q(func: eq(tag, #{tag})) @filter(eq(age, #{age}) and eq(name, "#{name}")) { #{body} } }`
+
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{"where int32", c.BuildQuery(testUserSchema()).Where("age", "eq", int32(20))},
+		{"where uint", c.BuildQuery(testUserSchema()).Where("age", "eq", uint(20))},
+		{"paging float32", c.BuildQuery(testUserSchema()).SetSortOption("age", "asc").Paging(float32(20), nil, 10)},
+		{"filter int list", c.BuildQuery(testUserSchema()).Filter(Eq("age", []int{20, 21}))},
+		{"facet", c.BuildRelation(users[0], follows).Where("since", "gt", int32(0))},
+		{"raw arg", c.BuildRawQuery(base, testUserSchema(), map[string]interface{}{"age": int32(20), "name": "alice"})},
+		{"quoted raw arg", c.BuildRawQuery(base, testUserSchema(), map[string]interface{}{"age": 20, "name": []int{1}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.query.All(); !errors.HasCode(err, errors.InvalidQuery) {
+				t.Errorf("All() = %v, want InvalidQuery", err)
+			}
+		})
+	}
+}
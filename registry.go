@@ -1,42 +1,80 @@
 package graphor
 
 import (
+	"context"
+	"time"
+
 	"github.com/nosukeru/graphor/auth"
 	"github.com/nosukeru/graphor/database"
 )
 
-var __graphor graphorInterface
+var __graphor *Client
 
-func InitializeGraphor() error {
+// InitializeGraphor connects the default client to dgraph with given options, or database.OptionsFromEnv if omitted.
+func InitializeGraphor(opts ...database.Options) error {
 	var err error
-	__graphor, err = newGraphor()
+	__graphor, err = NewClient(opts...)
 	return err
 }
 
+// InitializeGraphorWithDatabase sets up the default client on top of given database.
+func InitializeGraphorWithDatabase(db database.Database) {
+	__graphor = NewClientWithDatabase(db)
+}
+
+// DefaultClient returns the client used by package-level functions.
+func DefaultClient() *Client {
+	return __graphor
+}
+
 func Auth() auth.Auth {
 	return __graphor.Auth()
 }
 
-func db() database.Database {
-	return __graphor.DB()
+func BuildQuery(schema Schema) Query {
+	return __graphor.BuildQuery(schema)
 }
 
-func Save(model Model, schema Schema) {
-	__graphor.Save(model, schema)
+func BuildRawQuery(qStr string, schema Schema, args map[string]interface{}) Query {
+	return __graphor.BuildRawQuery(qStr, schema, args)
 }
 
-func Delete(model Model) {
-	__graphor.Delete(model)
+func BuildRelation(parent Model, rs RelationSchema) Relation {
+	return __graphor.BuildRelation(parent, rs)
 }
 
-func HardDelete(model Model) {
-	__graphor.HardDelete(model)
+func NewRelationLoader(rs RelationSchema, scopes ...func(q Query) Query) *RelationLoader {
+	return __graphor.NewRelationLoader(rs, scopes...)
 }
 
-func Mutate(execute func() error) error {
+func Mutate(execute func(m *Mutation) error) error {
 	return __graphor.Mutate(execute)
 }
 
+func MutateContext(ctx context.Context, execute func(m *Mutation) error) error {
+	return __graphor.MutateContext(ctx, execute)
+}
+
+func Transaction(execute func(tx *Tx) error) error {
+	return __graphor.Transaction(execute)
+}
+
+func TransactionContext(ctx context.Context, execute func(tx *Tx) error) error {
+	return __graphor.TransactionContext(ctx, execute)
+}
+
+func Upsert(model Model, schema Schema, keyFields ...string) error {
+	return __graphor.Upsert(model, schema, keyFields...)
+}
+
+func UpsertContext(ctx context.Context, model Model, schema Schema, keyFields ...string) error {
+	return __graphor.UpsertContext(ctx, model, schema, keyFields...)
+}
+
+func Close() error {
+	return __graphor.Close()
+}
+
 func ClearDatabase() error {
 	return __graphor.ClearDatabase()
 }
@@ -46,17 +84,53 @@ func MigrateDatabase(body string) error {
 }
 
 func ReverseEdge(edge string) string {
-	return __graphor.ReverseEdge(edge)
+	return reverseEdge(edge)
 }
 
 func IsReversed(edge string) bool {
-	return __graphor.IsReversed(edge)
+	return isReversed(edge)
 }
 
 func BaseMigrations(schemaList []Schema) string {
 	return __graphor.BaseMigrations(schemaList)
 }
 
+func PlanMigration(schemaList []Schema) (*MigrationPlan, error) {
+	return __graphor.PlanMigration(schemaList)
+}
+
+func PlanMigrationContext(ctx context.Context, schemaList []Schema) (*MigrationPlan, error) {
+	return __graphor.PlanMigrationContext(ctx, schemaList)
+}
+
+func Migrate(up bool) error {
+	return __graphor.Migrate(up)
+}
+
+func MigrateContext(ctx context.Context, up bool) error {
+	return __graphor.MigrateContext(ctx, up)
+}
+
+func MigrateTo(version string) error {
+	return __graphor.MigrateTo(version)
+}
+
+func MigrateToContext(ctx context.Context, version string) error {
+	return __graphor.MigrateToContext(ctx, version)
+}
+
+func AppliedMigrations() ([]string, error) {
+	return __graphor.AppliedMigrations()
+}
+
+func Backfill(schema Schema, opts BackfillOptions, execute func(m *Mutation, data QueryData) error) error {
+	return __graphor.Backfill(schema, opts, execute)
+}
+
+func BackfillContext(ctx context.Context, schema Schema, opts BackfillOptions, execute func(m *Mutation, data QueryData) error) error {
+	return __graphor.BackfillContext(ctx, schema, opts, execute)
+}
+
 func DecodeString(x interface{}) string {
 	return decodeString(x)
 }
@@ -64,3 +138,11 @@ func DecodeString(x interface{}) string {
 func DecodeInt(x interface{}) int {
 	return decodeInt(x)
 }
+
+func DecodeFloat(x interface{}) float64 {
+	return decodeFloat(x)
+}
+
+func DecodeTime(x interface{}) time.Time {
+	return decodeTime(x)
+}
@@ -1,17 +1,21 @@
 package graphor
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
+
+	"github.com/nosukeru/graphor/errors"
 )
 
 type Relation interface {
 	Query
-	Add(child Model, facets ...map[string]interface{})
-	Remove(child Model)
-	Clear()
-	Set(child Model, facets ...map[string]interface{})
+	Add(m Mutator, child Model, facets ...map[string]interface{})
+	Remove(m Mutator, child Model)
+	Clear(m Mutator)
+	Set(m Mutator, child Model, facets ...map[string]interface{})
 }
 
 type relation struct {
@@ -22,27 +26,36 @@ type relation struct {
 	SortedByFacet  bool
 }
 
-func BuildRelation(parent Model, rs RelationSchema) Relation {
+func buildRelation(client *Client, parent Model, rs RelationSchema) Relation {
+	r := newRelation(client, rs, parent.GetUid())
+	r.Parent = parent
+
+	return r
+}
+
+// newRelation builds relation query of rs for parents of uids.
+func newRelation(client *Client, rs RelationSchema, uids ...string) *relation {
 	qRelation := `
 	{
-		q(func: uid(<#{uid}>)) {
+		q(func: uid(#{uids})) {
+			uid
 			#{edge} #{sorting} #{facets} #{facets_filter} #{filter} #{take} { #{body} }	
 		}
 	}`
 
-	q := build(qRelation, rs.SchemaFunc(), map[string]interface{}{
-		"uid":  parent.GetUid(),
+	q := build(client, qRelation, rs.SchemaFunc(), map[string]interface{}{
+		"uids": Raw("<" + strings.Join(uids, ">, <") + ">"),
 		"edge": rs.Edge,
 	})
+	if !isValidUid(uids...) {
+		q.fail(invalidQuery("BuildRelation", "uid", strings.Join(uids, ", ")))
+	}
 
-	r := &relation{
+	return &relation{
 		query:          *q,
-		Parent:         parent,
 		RelationSchema: rs,
 		FacetsFilter:   []string{},
 	}
-
-	return r
 }
 
 func (r *relation) SetSortOption(key string, order string) Query {
@@ -70,7 +83,16 @@ func (r *relation) Take(count int) Query {
 
 func (r *relation) Where(field string, op string, value interface{}) Query {
 	if facet, ok := r.RelationSchema.Facets[field]; ok { // facets
-		r.FacetsFilter = append(r.FacetsFilter, fmt.Sprintf("%s(%s, %s)", op, facet.Edge, eval(value)))
+		if !isSafeToken(op) {
+			r.fail(invalidQuery("Where", "op", op))
+			return r
+		}
+		name, err := r.Vars.add(value)
+		if err != nil {
+			r.fail(err)
+			return r
+		}
+		r.FacetsFilter = append(r.FacetsFilter, fmt.Sprintf("%s(%s, %s)", op, facet.Edge, name))
 	} else {
 		r.query.Where(field, op, value)
 	}
@@ -102,29 +124,108 @@ func (r *relation) Regex(field, regex string) Query {
 	return r
 }
 
+func (r *relation) Search(field string, text string) Query {
+	r.query.Search(field, text)
+	return r
+}
+
+func (r *relation) SearchAll(field string, text string) Query {
+	r.query.SearchAll(field, text)
+	return r
+}
+
+func (r *relation) Fuzzy(field string, value string, distance int) Query {
+	r.query.Fuzzy(field, value, distance)
+	return r
+}
+
+func (r *relation) RegexCI(field string, pattern string) Query {
+	r.query.RegexCI(field, pattern)
+	return r
+}
+
+func (r *relation) Near(field string, point GeoPoint, meters float64) Query {
+	r.query.Near(field, point, meters)
+	return r
+}
+
+func (r *relation) Within(field string, polygon Polygon) Query {
+	r.query.Within(field, polygon)
+	return r
+}
+
+func (r *relation) Filter(expr Expr) Query {
+	r.query.Filter(expr)
+	return r
+}
+
 func (r *relation) Scope(filter func(q Query) Query) Query {
 	r.query.Scope(filter)
 	return r
 }
 
+func (r *relation) With(name string, scopes ...func(q Query) Query) Query {
+	r.query.With(name, scopes...)
+	return r
+}
+
 func (r *relation) Identify(uids ...string) Query {
 	r.query.Identify(uids...)
 	return r
 }
 
+func (r *relation) As(loginUid string) Query {
+	r.query.As(loginUid)
+	return r
+}
+
 func (r *relation) Debug() Query {
 	r.query.Debug()
 	return r
 }
 
 func (r *relation) Execute() ([]interface{}, error) {
+	return r.ExecuteContext(r.context())
+}
+
+func (r *relation) ExecuteContext(ctx context.Context) ([]interface{}, error) {
+	r.setArgs()
+	return r.query.ExecuteContext(ctx)
+}
+
+func (r *relation) executeJSON(ctx context.Context) ([]json.RawMessage, error) {
+	r.setArgs()
+	res, err := r.query.executeJSON(ctx)
+	if err != nil || len(res) == 0 {
+		return res, err
+	}
+
+	parent := map[string]json.RawMessage{}
+	err = json.Unmarshal(res[0], &parent)
+	if err != nil {
+		return nil, errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(res[0]))
+	}
+
+	children := []json.RawMessage{}
+	if edges, ok := parent[r.RelationSchema.Edge]; ok {
+		err = json.Unmarshal(edges, &children)
+		if err != nil {
+			return nil, errors.New(errors.UnmarshalizeFailed, err.Error()).Add("body", string(edges))
+		}
+	}
+
+	return children, nil
+}
+
+// setArgs fills relation specific args (edge sorting, facets, take) of the base query.
+func (r *relation) setArgs() {
 	facets := []string{}
 
 	if r.SortedByFacet {
 		facets = append(facets, fmt.Sprintf("order%s: %s", r.SortOrder, r.RelationSchema.Facets[r.SortKey].Edge))
-		r.Args["sorting"] = ""
+		r.Args["sorting"] = Raw("")
 	} else {
-		r.Args["sorting"] = fmt.Sprintf("(order%s: %s)", r.SortOrder, r.SortKey)
+		r.Args["sorting"] = Raw(fmt.Sprintf("(order%s: %s)", r.SortOrder, r.SortKey))
 	}
 
 	for name, f := range r.RelationSchema.Facets {
@@ -132,26 +233,67 @@ func (r *relation) Execute() ([]interface{}, error) {
 	}
 
 	if len(facets) > 0 {
-		r.Args["facets"] = "@facets(" + strings.Join(facets, ", ") + ")"
+		r.Args["facets"] = Raw("@facets(" + strings.Join(facets, ", ") + ")")
 	} else {
-		r.Args["facets"] = ""
+		r.Args["facets"] = Raw("")
 	}
 
 	if len(r.FacetsFilter) > 0 {
-		r.query.Args["facets_filter"] = "@facets(" + strings.Join(r.FacetsFilter, " and ") + ")"
+		r.query.Args["facets_filter"] = Raw("@facets(" + strings.Join(r.FacetsFilter, " and ") + ")")
 	} else {
-		r.query.Args["facets_filter"] = ""
+		r.query.Args["facets_filter"] = Raw("")
 	}
 
 	if r.TakeCount > 0 {
-		r.Args["take"] = fmt.Sprintf("(first: %d)", r.TakeCount)
+		r.Args["take"] = Raw(fmt.Sprintf("(first: %d)", r.TakeCount))
+	}
+}
+
+// includeOptions renders filters, sorting and take of rs scoped by scopes, to include rs into parent query.
+// Values of filters are added to vars of the parent query.
+func includeOptions(rs RelationSchema, vars *variables, scopes ...func(q Query) Query) (string, error) {
+	r := &relation{
+		query: query{
+			Args:      map[string]interface{}{},
+			Filters:   []string{},
+			SortKey:   "created_at",
+			SortOrder: "desc",
+			Vars:      vars,
+		},
+		RelationSchema: rs,
+		FacetsFilter:   []string{},
+	}
+
+	for _, scope := range scopes {
+		scope(r)
+	}
+	if r.Err != nil {
+		return "", r.Err
+	}
+	if !isSafeToken(r.SortKey) || (r.SortOrder != "asc" && r.SortOrder != "desc") {
+		return "", invalidQuery("SetSortOption", "key", r.SortKey).Add("order", r.SortOrder)
+	}
+	r.setArgs()
+
+	filters := append(r.Filters, "not has(deleted_at)")
+	r.Args["filter"] = Raw(fmt.Sprintf("@filter(%s)", strings.Join(filters, " and ")))
+
+	options := []string{}
+	for _, name := range []string{"sorting", "facets", "facets_filter", "filter", "take"} {
+		if option, ok := r.Args[name].(Raw); ok && option != "" {
+			options = append(options, string(option))
+		}
 	}
 
-	return r.query.Execute()
+	return strings.Join(options, " "), nil
 }
 
 func (r *relation) First() (QueryData, error) {
-	res, err := r.Take(1).Execute()
+	return r.FirstContext(r.context())
+}
+
+func (r *relation) FirstContext(ctx context.Context) (QueryData, error) {
+	res, err := r.Take(1).ExecuteContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +302,8 @@ func (r *relation) First() (QueryData, error) {
 		return nil, nil
 	}
 
-	children := res[0].(map[string]interface{})[r.RelationSchema.Edge].([]interface{})
+	// parent without children is returned only with uid
+	children, _ := res[0].(map[string]interface{})[r.RelationSchema.Edge].([]interface{})
 	if len(children) == 0 {
 		return nil, nil
 	}
@@ -169,7 +312,11 @@ func (r *relation) First() (QueryData, error) {
 }
 
 func (r *relation) All() ([]QueryData, error) {
-	res, err := r.Execute()
+	return r.AllContext(r.context())
+}
+
+func (r *relation) AllContext(ctx context.Context) ([]QueryData, error) {
+	res, err := r.ExecuteContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +325,8 @@ func (r *relation) All() ([]QueryData, error) {
 		return []QueryData{}, nil
 	}
 
-	children := res[0].(map[string]interface{})[r.RelationSchema.Edge].([]interface{})
+	// parent without children is returned only with uid
+	children, _ := res[0].(map[string]interface{})[r.RelationSchema.Edge].([]interface{})
 	dataList := []QueryData{}
 	for _, child := range children {
 		dataList = append(dataList, r.Schema.Decode(child))
@@ -210,15 +358,37 @@ func (r *relation) Paging(since interface{}, until interface{}, count int) Query
 }
 
 func (r *relation) Exists() (bool, error) {
-	dataList, err := r.Take(1).All()
+	return r.ExistsContext(r.context())
+}
+
+func (r *relation) ExistsContext(ctx context.Context) (bool, error) {
+	dataList, err := r.Take(1).AllContext(ctx)
 	return len(dataList) > 0, err
 }
 
 func (r *relation) Count() (int, error) {
-	return r.query.Count()
+	return r.CountContext(r.context())
+}
+
+func (r *relation) CountContext(ctx context.Context) (int, error) {
+	r.Schema = CountSchema(r.Schema.Tag)
+
+	res, err := r.ExecuteContext(ctx)
+	if err != nil || len(res) == 0 {
+		return 0, err
+	}
+
+	// parent without children is returned only with uid
+	children, _ := res[0].(map[string]interface{})[r.RelationSchema.Edge].([]interface{})
+	if len(children) == 0 {
+		return 0, nil
+	}
+
+	data, _ := children[0].(map[string]interface{})
+	return decodeInt(data["count"]), nil
 }
 
-func (r *relation) add(child Model, facets ...map[string]interface{}) {
+func (r *relation) add(m Mutator, child Model, facets ...map[string]interface{}) {
 	if r.Parent == nil || r.Parent.isEmpty() {
 		log.Print("Relation.Add failed: Parent is empty.")
 		return
@@ -229,7 +399,7 @@ func (r *relation) add(child Model, facets ...map[string]interface{}) {
 		return
 	}
 
-	if IsReversed(r.RelationSchema.Edge) {
+	if isReversed(r.RelationSchema.Edge) {
 		log.Print("Relation.Add failed: Can't add to reversed edge.")
 		return
 	}
@@ -239,7 +409,12 @@ func (r *relation) add(child Model, facets ...map[string]interface{}) {
 
 	if len(facets) > 0 {
 		for name, value := range facets[0] {
-			fields = append(fields, fmt.Sprintf(`"%s|%s": %s`, r.RelationSchema.Edge, r.RelationSchema.Facets[name].Edge, eval(value)))
+			v, ok := eval(value)
+			if !ok {
+				log.Printf("Relation.Add failed: Unsupported value for facet %q.", name)
+				return
+			}
+			fields = append(fields, fmt.Sprintf(`"%s|%s": %s`, r.RelationSchema.Edge, r.RelationSchema.Facets[name].Edge, v))
 		}
 	}
 
@@ -250,19 +425,19 @@ func (r *relation) add(child Model, facets ...map[string]interface{}) {
 		}
 	}`, r.Parent.GetUid(), r.RelationSchema.Edge, strings.Join(fields, ",\n"))
 
-	db().Insert(q)
+	m.mutation().buffer.Insert(q)
 }
 
-func (r *relation) Add(child Model, facets ...map[string]interface{}) {
+func (r *relation) Add(m Mutator, child Model, facets ...map[string]interface{}) {
 	if !r.RelationSchema.HasMany {
 		log.Print("Relation.Add failed: Don't use Relation.Add for 'hasOne' relation. Use Relation.Set instead.")
 		return
 	}
 
-	r.add(child, facets...)
+	r.add(m, child, facets...)
 }
 
-func (r *relation) Remove(child Model) {
+func (r *relation) Remove(m Mutator, child Model) {
 	if r.Parent == nil || !r.Parent.isSaved() {
 		log.Print("Relation.Remove failed: Parent is empty or not saved.")
 		return
@@ -273,7 +448,7 @@ func (r *relation) Remove(child Model) {
 		return
 	}
 
-	if IsReversed(r.RelationSchema.Edge) {
+	if isReversed(r.RelationSchema.Edge) {
 		log.Print("Relation.Remove failed: Can't remove reversed edge.")
 		return
 	}
@@ -288,15 +463,15 @@ func (r *relation) Remove(child Model) {
 		%q: {"uid": %q}
 	}`, r.Parent.GetUid(), r.RelationSchema.Edge, child.GetUid())
 
-	db().Delete(q)
+	m.mutation().buffer.Delete(q)
 }
 
-func (r *relation) Clear() {
+func (r *relation) Clear(m Mutator) {
 	if r.Parent == nil || !r.Parent.isSaved() {
 		return
 	}
 
-	if IsReversed(r.RelationSchema.Edge) {
+	if isReversed(r.RelationSchema.Edge) {
 		log.Print("Relation.Clear failed: Can't clear reversed edge.")
 	}
 
@@ -307,14 +482,14 @@ func (r *relation) Clear() {
 		}
 	`, r.Parent.GetUid(), r.RelationSchema.Edge)
 
-	db().Delete(q)
+	m.mutation().buffer.Delete(q)
 }
 
-func (r *relation) Set(child Model, facets ...map[string]interface{}) {
+func (r *relation) Set(m Mutator, child Model, facets ...map[string]interface{}) {
 	if r.RelationSchema.HasMany {
 		log.Print("Relation.Set failed: Don't use Relation.Set for 'hasMany' relation. Use Relation.Add instead.")
 	}
 
-	r.Clear()
-	r.add(child, facets...)
+	r.Clear(m)
+	r.add(m, child, facets...)
 }
@@ -0,0 +1,145 @@
+package graphor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nosukeru/graphor/database"
+)
+
+type testUser struct {
+	ModelProperty `graphor:"tag=1"`
+	Name          string      `json:"name" graphor:"field,index=exact"`
+	Age           int         `json:"age" graphor:"field,index=int"`
+	Follows       []*testUser `json:"follows,omitempty" graphor:"relation,edge=follow,facet=since:since"`
+}
+
+func testUserSchema() Schema {
+	return SchemaOf(&testUser{})
+}
+
+func newTestClient() *Client {
+	return NewClientWithDatabase(database.NewMemoryDatabase())
+}
+
+// saveTestUsers saves users with given names and returns them in the same order.
+func saveTestUsers(t *testing.T, c *Client, names ...string) []*testUser {
+	t.Helper()
+
+	users := []*testUser{}
+	err := c.Mutate(func(m *Mutation) error {
+		for i, name := range names {
+			user := &testUser{Name: name, Age: 20 + i}
+			if err := m.Save(user, testUserSchema()); err != nil {
+				return err
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return users
+}
+
+func TestRelationQueries(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob", "carol")
+	follows := testUserSchema().Relations["follows"]
+
+	err := c.Mutate(func(m *Mutation) error {
+		c.BuildRelation(users[0], follows).Add(m, users[1])
+		c.BuildRelation(users[0], follows).Add(m, users[2])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		parent *testUser
+		count  int
+	}{
+		{"no children", users[1], 0},
+		{"some children", users[0], 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all, err := c.BuildRelation(tt.parent, follows).All()
+			if err != nil || len(all) != tt.count {
+				t.Errorf("All() = %d children, %v; want %d", len(all), err, tt.count)
+			}
+
+			first, err := c.BuildRelation(tt.parent, follows).First()
+			if err != nil || (first != nil) != (tt.count > 0) {
+				t.Errorf("First() = %v, %v", first, err)
+			}
+
+			exists, err := c.BuildRelation(tt.parent, follows).Exists()
+			if err != nil || exists != (tt.count > 0) {
+				t.Errorf("Exists() = %t, %v", exists, err)
+			}
+
+			count, err := c.BuildRelation(tt.parent, follows).CountContext(context.Background())
+			if err != nil || count != tt.count {
+				t.Errorf("CountContext() = %d, %v; want %d", count, err, tt.count)
+			}
+
+			found, err := Find[*testUser](c.BuildRelation(tt.parent, follows))
+			if err != nil || len(found) != tt.count {
+				t.Errorf("Find() = %d children, %v; want %d", len(found), err, tt.count)
+			}
+			for _, user := range found {
+				if user.GetUid() == "" || user.Name == "" {
+					t.Errorf("Find() decoded %+v", user)
+				}
+			}
+
+			typed, err := TypedRelation[*testUser]{c.BuildRelation(tt.parent, follows)}.Find()
+			if err != nil || len(typed) != tt.count {
+				t.Errorf("TypedRelation.Find() = %d children, %v; want %d", len(typed), err, tt.count)
+			}
+		})
+	}
+}
+
+func TestRelationAddFacets(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice", "bob")
+	follows := testUserSchema().Relations["follows"]
+
+	tests := []struct {
+		name  string
+		value interface{}
+		added bool
+	}{
+		{"int", 5, true},
+		{"int32", int32(5), true},
+		{"float32", float32(1.5), true},
+		{"datetime", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"nil", nil, false},
+		{"unsupported", make(chan int), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMutation(context.Background(), c)
+			c.BuildRelation(users[0], follows).Add(m, users[1], map[string]interface{}{"since": tt.value})
+
+			if added := !m.buffer.IsEmpty(); added != tt.added {
+				t.Fatalf("Add() buffered %v, want added %t", m.buffer.Insertions, tt.added)
+			}
+			for _, q := range m.buffer.Insertions {
+				if !json.Valid([]byte(q)) {
+					t.Errorf("Add() buffered invalid JSON %s", q)
+				}
+			}
+		})
+	}
+}
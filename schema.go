@@ -2,9 +2,42 @@ package graphor
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
+// FieldSchema describes dgraph type and indexes of a field.
+type FieldSchema struct {
+	Type   string   // string, int, float, bool, datetime, geo, password ("string" if empty)
+	Index  []string // tokenizers (e.g. exact, term, fulltext, trigram, hash, int)
+	Lang   bool
+	Count  bool
+	List   bool
+	Upsert bool
+}
+
+func (f FieldSchema) predicate(name string) predicate {
+	t := f.Type
+	if t == "" {
+		t = "string"
+	}
+
+	index := f.Index
+	if t == "geo" && len(index) == 0 {
+		index = []string{"geo"} // geo functions need geo index
+	}
+
+	return predicate{
+		Name:   name,
+		Type:   t,
+		Index:  index,
+		Lang:   f.Lang,
+		Count:  f.Count,
+		List:   f.List,
+		Upsert: f.Upsert,
+	}
+}
+
 type Facet struct {
 	Edge string
 }
@@ -25,10 +58,12 @@ type RelationSchema struct {
 }
 
 type Schema struct {
-	Tag       int
-	Fields    []string
-	Booleans  map[string]Boolean
-	Relations map[string]RelationSchema
+	Tag          int
+	Fields       []string
+	FieldSchemas map[string]FieldSchema // typed definitions; these fields needn't be listed in Fields
+	Unique       []string               // fields which must be unique among records of Tag
+	Booleans     map[string]Boolean
+	Relations    map[string]RelationSchema
 }
 
 func EmptySchema() Schema {
@@ -45,7 +80,37 @@ func CountSchema(tag int) Schema {
 }
 
 func (schema Schema) Build() string {
-	edges := schema.Fields
+	return schema.build(Auth().GetLoginUid())
+}
+
+// fields returns Fields followed by fields only defined in FieldSchemas.
+func (schema Schema) fields() []string {
+	fields := append([]string{}, schema.Fields...)
+	listed := map[string]bool{}
+	for _, field := range fields {
+		listed[field] = true
+	}
+
+	extra := []string{}
+	for name := range schema.FieldSchemas {
+		if !listed[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	return append(fields, extra...)
+}
+
+// build generates query body, evaluating booleans against loginUid (skipped if empty or invalid).
+// Password fields are saved but never fetched, since dgraph refuses to return them (use checkpwd instead).
+func (schema Schema) build(loginUid string) string {
+	edges := []string{}
+	for _, field := range schema.fields() {
+		if schema.FieldSchemas[field].Type != "password" {
+			edges = append(edges, field)
+		}
+	}
 	if len(edges) == 0 || edges[0] != "count(uid)" {
 		edges = append(edges, "uid", "created_at", "updated_at", "deleted_at")
 	}
@@ -53,8 +118,8 @@ func (schema Schema) Build() string {
 	for name, b := range schema.Booleans {
 		filter := b.Filter
 
-		if Auth().IsLogin() {
-			filter = strings.Replace(filter, "#{login_uid}", Auth().GetLoginUid(), -1)
+		if isValidUid(loginUid) {
+			filter = strings.Replace(filter, "#{login_uid}", loginUid, -1)
 		} else {
 			continue
 		}
@@ -72,13 +137,49 @@ func (schema Schema) Build() string {
 		}
 
 		if r.Include {
-			edges = append(edges, fmt.Sprintf("%s: %s %s {\n%s\n}", name, r.Edge, r.IncludeOptions, r.SchemaFunc().Build()))
+			edges = append(edges, fmt.Sprintf("%s: %s %s {\n%s\n}", name, r.Edge, r.IncludeOptions, r.SchemaFunc().build(loginUid)))
 		}
 	}
 
 	return strings.Join(edges, "\n")
 }
 
+// with returns a copy of schema including relation at path. Relations on the way are included
+// with their facets and soft-delete filter, unless already included. Values of scopes go to vars.
+func (schema Schema) with(path string, vars *variables, scopes ...func(q Query) Query) (Schema, error) {
+	name, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+
+	rs, ok := schema.Relations[name]
+	if !ok {
+		return schema, invalidQuery("With", "relation", path)
+	}
+
+	if rest != "" {
+		child, err := rs.SchemaFunc().with(rest, vars, scopes...)
+		if err != nil {
+			return schema, err
+		}
+		rs.SchemaFunc = func() Schema { return child }
+		scopes = nil
+	}
+
+	if rest == "" || !rs.Include {
+		options, err := includeOptions(rs, vars, scopes...)
+		if err != nil {
+			return schema, err
+		}
+		rs.IncludeOptions = options
+	}
+	rs.Include = true
+
+	res := schema.clone()
+	res.Relations[name] = rs
+	return res, nil
+}
+
 func (schema Schema) Decode(src interface{}) QueryData {
 	hash := src.(map[string]interface{})
 
@@ -90,7 +191,10 @@ func (schema Schema) Decode(src interface{}) QueryData {
 	for name, r := range schema.Relations {
 		if r.Include {
 			if edges, ok := hash[name]; ok {
-				children := edges.([]interface{})
+				children, ok := edges.([]interface{})
+				if !ok {
+					children = []interface{}{edges} // single node
+				}
 				schema := r.SchemaFunc()
 				if r.HasMany {
 					res := []interface{}{}
@@ -98,8 +202,10 @@ func (schema Schema) Decode(src interface{}) QueryData {
 						res = append(res, schema.Decode(child))
 					}
 					hash[name] = res
-				} else {
+				} else if len(children) > 0 {
 					hash[name] = schema.Decode(children[0])
+				} else {
+					delete(hash, name)
 				}
 			} else if r.HasMany {
 				hash[name] = []interface{}{}
@@ -0,0 +1,268 @@
+package graphor
+
+import (
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const schemaTagKey = "graphor"
+
+var (
+	schemaCache    sync.Map // reflect.Type -> Schema
+	modelProperty  = reflect.TypeOf(ModelProperty{})
+	modelInterface = reflect.TypeOf((*Model)(nil)).Elem()
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// SchemaOf derives Schema of model from `graphor` struct tags. The result is cached per type.
+//
+//	type User struct {
+//		graphor.ModelProperty `graphor:"tag=1"`
+//		Id          string  `json:"id" graphor:"field,index=exact,unique"`
+//		Name        string  `json:"name" graphor:"field,index=trigram"`
+//		Icon        *Image  `json:"icon" graphor:"relation,edge=has_icon,include"`
+//		Follows     []*User `json:"follows" graphor:"relation,edge=follow,many,count=follow_count,facet=followed_at:at"`
+//		FollowCount int     `json:"follow_count"`
+//		IsFollowing bool    `json:"is_following" graphor:"boolean,edge=~follow,filter=uid(<#{login_uid}>)"`
+//	}
+func SchemaOf(model interface{}) Schema {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return schemaOf(t).clone()
+}
+
+func schemaOf(t reflect.Type) Schema {
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(Schema)
+	}
+
+	schema := Schema{
+		FieldSchemas: map[string]FieldSchema{},
+		Booleans:     map[string]Boolean{},
+		Relations:    map[string]RelationSchema{},
+	}
+	collectSchema(t, &schema)
+
+	cached, _ := schemaCache.LoadOrStore(t, schema)
+	return cached.(Schema)
+}
+
+func collectSchema(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup(schemaTagKey)
+
+		if f.Type == modelProperty {
+			for key, value := range parseSchemaTag(tag) {
+				if key != "tag" {
+					log.Printf("graphor: unknown option %q for ModelProperty of %s", key, t)
+					continue
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					log.Printf("graphor: invalid tag %q of %s", value, t)
+					continue
+				}
+				schema.Tag = n
+			}
+			continue
+		}
+
+		// fields of embedded structs (e.g. UserModel) belong to the model itself
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			collectSchema(f.Type, schema)
+			continue
+		}
+
+		if !tagged {
+			continue
+		}
+
+		name := jsonName(f)
+		if name == "" {
+			log.Printf("graphor: field %s of %s is tagged but not serialized", f.Name, t)
+			continue
+		}
+
+		kind, rest := tag, ""
+		if sep := strings.Index(tag, ","); sep >= 0 {
+			kind, rest = tag[:sep], tag[sep+1:]
+		}
+		options := parseSchemaTag(rest)
+
+		switch kind {
+		case "field":
+			fs := FieldSchema{Type: options["type"]}
+			if fs.Type == "" {
+				fs.Type, fs.List = scalarType(f.Type)
+			}
+			if index := options["index"]; index != "" {
+				fs.Index = strings.Split(index, "+")
+			}
+			_, fs.Lang = options["lang"]
+			_, fs.Count = options["count"]
+			_, fs.Upsert = options["upsert"]
+			if _, ok := options["list"]; ok {
+				fs.List = true
+			}
+			schema.FieldSchemas[name] = fs
+
+			if _, ok := options["unique"]; ok {
+				schema.Unique = append(schema.Unique, name)
+			}
+		case "boolean":
+			schema.Booleans[name] = Boolean{
+				Edge:   options["edge"],
+				Filter: options["filter"],
+			}
+		case "relation":
+			elem := f.Type
+			for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice {
+				elem = elem.Elem()
+			}
+			if !reflect.PtrTo(elem).Implements(modelInterface) {
+				log.Printf("graphor: relation %s of %s is not a graphor model", f.Name, t)
+				continue
+			}
+
+			_, many := options["many"]
+			_, include := options["include"]
+			rs := RelationSchema{
+				Edge:           options["edge"],
+				HasMany:        many || f.Type.Kind() == reflect.Slice,
+				Include:        include,
+				IncludeOptions: options["options"],
+				CountField:     options["count"],
+				Facets:         map[string]Facet{},
+				SchemaFunc:     func() Schema { return schemaOf(elem).clone() },
+			}
+			if facets := options["facet"]; facets != "" {
+				for _, facet := range strings.Split(facets, "+") {
+					parts := strings.SplitN(facet, ":", 2)
+					edge := parts[0]
+					if len(parts) == 2 {
+						edge = parts[1]
+					}
+					rs.Facets[parts[0]] = Facet{Edge: edge}
+				}
+			}
+			schema.Relations[name] = rs
+		default:
+			log.Printf("graphor: unknown kind %q for field %s of %s", kind, f.Name, t)
+		}
+	}
+}
+
+// parseSchemaTag splits comma separated key=value options. Commas inside parentheses
+// (e.g. filter=eq(name, "a")) don't split options.
+func parseSchemaTag(tag string) map[string]string {
+	options := map[string]string{}
+	depth, start := 0, 0
+
+	add := func(option string) {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return
+		}
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) == 2 {
+			options[kv[0]] = kv[1]
+		} else {
+			options[kv[0]] = ""
+		}
+	}
+
+	for i, c := range tag {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(tag[start:])
+
+	return options
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// scalarType maps go type to dgraph type, and whether it's a list.
+func scalarType(t reflect.Type) (string, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == geoPointType || t == polygonType {
+		return "geo", false
+	}
+	if t == timeType {
+		return "datetime", false
+	}
+
+	list := false
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		list = true
+		t = t.Elem()
+	}
+	if t == geoPointType || t == polygonType {
+		return "geo", list
+	}
+	if t == timeType {
+		return "datetime", list
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int", list
+	case reflect.Float32, reflect.Float64:
+		return "float", list
+	case reflect.Bool:
+		return "bool", list
+	}
+
+	return "string", list
+}
+
+// clone copies maps and slices of schema, so that callers can modify the result freely.
+func (schema Schema) clone() Schema {
+	res := schema
+	res.Fields = append([]string{}, schema.Fields...)
+	res.Unique = append([]string{}, schema.Unique...)
+
+	res.FieldSchemas = map[string]FieldSchema{}
+	for k, v := range schema.FieldSchemas {
+		res.FieldSchemas[k] = v
+	}
+	res.Booleans = map[string]Boolean{}
+	for k, v := range schema.Booleans {
+		res.Booleans[k] = v
+	}
+	res.Relations = map[string]RelationSchema{}
+	for k, v := range schema.Relations {
+		res.Relations[k] = v
+	}
+
+	return res
+}
@@ -0,0 +1,162 @@
+package graphor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSchemaTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"flags and values", "index=exact,unique", map[string]string{"index": "exact", "unique": ""}},
+		{"spaces and empty options", " edge=follow , ,many", map[string]string{"edge": "follow", "many": ""}},
+		{"plus separated", "index=term+trigram", map[string]string{"index": "term+trigram"}},
+		{"commas in parentheses", `filter=eq(name, "a"),edge=~follow`, map[string]string{"filter": `eq(name, "a")`, "edge": "~follow"}},
+		{"nested parentheses", "options=@facets(orderdesc: at) (first: 3),include", map[string]string{"options": "@facets(orderdesc: at) (first: 3)", "include": ""}},
+		{"equal in value", "filter=x=y", map[string]string{"filter": "x=y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSchemaTag(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSchemaTag(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+type tagTestProfile struct {
+	Bio string `json:"bio" graphor:"field,index=fulltext"`
+}
+
+type tagTestUser struct {
+	ModelProperty `graphor:"tag=7"`
+	tagTestProfile
+	Id          string         `json:"id" graphor:"field,index=exact,unique"`
+	Name        string         `json:"name" graphor:"field,index=term+trigram,lang,upsert"`
+	Age         int32          `json:"age" graphor:"field,index=int,count"`
+	Score       float64        `json:"score" graphor:"field"`
+	Active      bool           `json:"active" graphor:"field"`
+	Born        time.Time      `json:"born" graphor:"field"`
+	Tags        []string       `json:"tags" graphor:"field,index=exact"`
+	Raw         []byte         `json:"raw" graphor:"field"`
+	Codes       string         `json:"codes" graphor:"field,type=int,list"`
+	Location    GeoPoint       `json:"location" graphor:"field"`
+	Icon        *tagTestUser   `json:"icon" graphor:"relation,edge=has_icon,include"`
+	Follows     []*tagTestUser `json:"follows" graphor:"relation,edge=follow,count=follow_count,facet=followed_at:at+since"`
+	Friend      *tagTestUser   `json:"friend" graphor:"relation,edge=friend,many,options=(first: 3)"`
+	IsFollowing bool           `json:"is_following" graphor:"boolean,edge=~follow,filter=uid(<#{login_uid}>)"`
+	Hidden      string         `json:"-" graphor:"field"`
+	Unknown     string         `json:"unknown" graphor:"column"`
+	NotModel    *time.Time     `json:"not_model" graphor:"relation,edge=x"`
+	Untagged    string         `json:"untagged"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(&tagTestUser{})
+
+	if schema.Tag != 7 {
+		t.Errorf("Tag = %d, want 7", schema.Tag)
+	}
+	if !reflect.DeepEqual(schema.Unique, []string{"id"}) {
+		t.Errorf("Unique = %v, want [id]", schema.Unique)
+	}
+
+	fields := []struct {
+		name string
+		want FieldSchema
+	}{
+		{"bio", FieldSchema{Type: "string", Index: []string{"fulltext"}}},
+		{"id", FieldSchema{Type: "string", Index: []string{"exact"}}},
+		{"name", FieldSchema{Type: "string", Index: []string{"term", "trigram"}, Lang: true, Upsert: true}},
+		{"age", FieldSchema{Type: "int", Index: []string{"int"}, Count: true}},
+		{"score", FieldSchema{Type: "float"}},
+		{"active", FieldSchema{Type: "bool"}},
+		{"born", FieldSchema{Type: "datetime"}},
+		{"tags", FieldSchema{Type: "string", Index: []string{"exact"}, List: true}},
+		{"raw", FieldSchema{Type: "string"}},
+		{"codes", FieldSchema{Type: "int", List: true}},
+		{"location", FieldSchema{Type: "geo"}},
+	}
+	for _, tt := range fields {
+		t.Run("field "+tt.name, func(t *testing.T) {
+			if got := schema.FieldSchemas[tt.name]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FieldSchemas[%q] = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+	if len(schema.FieldSchemas) != len(fields) {
+		t.Errorf("FieldSchemas = %v, want only %d fields", schema.FieldSchemas, len(fields))
+	}
+
+	relations := []struct {
+		name string
+		want RelationSchema
+	}{
+		{"icon", RelationSchema{Edge: "has_icon", Include: true, Facets: map[string]Facet{}}},
+		{"follows", RelationSchema{Edge: "follow", HasMany: true, CountField: "follow_count", Facets: map[string]Facet{"followed_at": {Edge: "at"}, "since": {Edge: "since"}}}},
+		{"friend", RelationSchema{Edge: "friend", HasMany: true, IncludeOptions: "(first: 3)", Facets: map[string]Facet{}}},
+	}
+	for _, tt := range relations {
+		t.Run("relation "+tt.name, func(t *testing.T) {
+			got := schema.Relations[tt.name]
+			if got.SchemaFunc == nil || got.SchemaFunc().Tag != 7 {
+				t.Errorf("Relations[%q].SchemaFunc doesn't derive the related schema", tt.name)
+			}
+			got.SchemaFunc = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Relations[%q] = %+v, want %+v", tt.name, got, tt.want)
+			}
+		})
+	}
+	if len(schema.Relations) != len(relations) {
+		t.Errorf("Relations = %v, want only %d relations", schema.Relations, len(relations))
+	}
+
+	want := map[string]Boolean{"is_following": {Edge: "~follow", Filter: "uid(<#{login_uid}>)"}}
+	if !reflect.DeepEqual(schema.Booleans, want) {
+		t.Errorf("Booleans = %+v, want %+v", schema.Booleans, want)
+	}
+}
+
+func TestSchemaOfInvalidTags(t *testing.T) {
+	type invalidTag struct {
+		ModelProperty `graphor:"tag=x,table=users"`
+		Name          string `json:"name" graphor:"field"`
+	}
+
+	schema := SchemaOf(invalidTag{})
+	if schema.Tag != 0 {
+		t.Errorf("Tag = %d, want 0 for invalid tag", schema.Tag)
+	}
+	if _, ok := schema.FieldSchemas["name"]; !ok {
+		t.Errorf("FieldSchemas = %v, want fields after invalid tag", schema.FieldSchemas)
+	}
+}
+
+func TestSchemaOfCache(t *testing.T) {
+	first := SchemaOf(&tagTestUser{})
+	first.Unique = append(first.Unique, "name")
+	first.FieldSchemas["extra"] = FieldSchema{}
+	delete(first.Relations, "icon")
+
+	if _, ok := schemaCache.Load(reflect.TypeOf(tagTestUser{})); !ok {
+		t.Errorf("SchemaOf() didn't cache schema of the type")
+	}
+
+	second := SchemaOf(tagTestUser{})
+	if len(second.Unique) != 1 {
+		t.Errorf("Unique = %v, modified through an earlier result", second.Unique)
+	}
+	if _, ok := second.FieldSchemas["extra"]; ok {
+		t.Errorf("FieldSchemas = %v, modified through an earlier result", second.FieldSchemas)
+	}
+	if _, ok := second.Relations["icon"]; !ok {
+		t.Errorf("Relations = %v, modified through an earlier result", second.Relations)
+	}
+}
@@ -0,0 +1,45 @@
+package graphor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaBuildSkipsPassword(t *testing.T) {
+	schema := Schema{
+		Tag:    1,
+		Fields: []string{"name"},
+		FieldSchemas: map[string]FieldSchema{
+			"secret": {Type: "password"},
+		},
+	}
+
+	body := schema.build("")
+	if strings.Contains(body, "secret") {
+		t.Errorf("build() = %q, must not fetch password field", body)
+	}
+	if !strings.Contains(body, "name") {
+		t.Errorf("build() = %q, want name", body)
+	}
+
+	saved := false
+	for _, field := range schema.fields() {
+		saved = saved || field == "secret"
+	}
+	if !saved {
+		t.Errorf("fields() = %v, want password field to be saved", schema.fields())
+	}
+}
+
+func TestSchemaDecodeEmptyHasOne(t *testing.T) {
+	schema := Schema{
+		Relations: map[string]RelationSchema{
+			"icon": {Edge: "has_icon", Include: true, SchemaFunc: EmptySchema},
+		},
+	}
+
+	data := schema.Decode(map[string]interface{}{"uid": "0x1", "icon": []interface{}{}})
+	if _, ok := data["icon"]; ok {
+		t.Errorf("Decode() = %v, want no icon", data)
+	}
+}
@@ -0,0 +1,120 @@
+package graphor
+
+import (
+	"context"
+
+	"github.com/nosukeru/graphor/database"
+	"github.com/nosukeru/graphor/errors"
+)
+
+// maxTransactionRetries is how many times Transaction re-runs after conflicts with other transactions.
+const maxTransactionRetries = 3
+
+// Tx is a read-write transaction. Queries built by Tx and writes made through it
+// are committed or discarded together.
+type Tx struct {
+	*Mutation
+	txn database.Txn
+}
+
+func newTx(ctx context.Context, client *Client) *Tx {
+	tx := &Tx{
+		Mutation: newMutation(ctx, client),
+		txn:      client.DB().NewTxn(),
+	}
+	tx.Mutation.tx = tx
+	return tx
+}
+
+func (tx *Tx) BuildQuery(schema Schema) Query {
+	q := tx.Client.BuildQuery(schema).(*query)
+	q.Tx = tx
+	return q
+}
+
+func (tx *Tx) BuildRawQuery(qStr string, schema Schema, args map[string]interface{}) Query {
+	q := build(tx.Client, qStr, schema, args)
+	q.Tx = tx
+	return q
+}
+
+func (tx *Tx) BuildRelation(parent Model, rs RelationSchema) Relation {
+	r := buildRelation(tx.Client, parent, rs).(*relation)
+	r.Tx = tx
+	return r
+}
+
+// flush sends buffered writes to dgraph, so that following queries in the transaction can see them.
+func (tx *Tx) flush(ctx context.Context) error {
+	if tx.buffer.IsEmpty() {
+		return nil
+	}
+
+	res, err := tx.txn.Mutate(ctx, tx.buffer)
+	if err != nil {
+		return err
+	}
+
+	tx.buffer = database.NewMutation()
+	return tx.assignUids(res)
+}
+
+func (tx *Tx) query(ctx context.Context, q string, vars map[string]string) ([]interface{}, error) {
+	err := tx.flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.txn.Query(ctx, q, vars)
+}
+
+func (tx *Tx) queryJSON(ctx context.Context, q string, vars map[string]string) ([]byte, error) {
+	err := tx.flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.txn.QueryJSON(ctx, q, vars)
+}
+
+func (tx *Tx) commit() error {
+	err := tx.flush(tx.ctx)
+	if err != nil {
+		return err
+	}
+
+	return tx.txn.Commit(tx.ctx)
+}
+
+func (g *Client) Transaction(execute func(tx *Tx) error) error {
+	return g.TransactionContext(context.Background(), execute)
+}
+
+// TransactionContext runs execute in a single dgraph transaction, committing if it returns nil.
+// execute is re-run (up to maxTransactionRetries times) when the transaction is aborted by a conflict,
+// so it shouldn't have side effects other than through tx. Uids and timestamps of models saved,
+// deleted or upserted through tx are put back before each retry.
+func (g *Client) TransactionContext(ctx context.Context, execute func(tx *Tx) error) error {
+	for i := 0; ; i++ {
+		err := g.runTransaction(ctx, execute)
+		if err == nil || !errors.HasCode(err, errors.TxnAborted) || i >= maxTransactionRetries {
+			return err
+		}
+	}
+}
+
+func (g *Client) runTransaction(ctx context.Context, execute func(tx *Tx) error) error {
+	tx := newTx(ctx, g)
+	defer tx.txn.Discard(ctx)
+
+	err := execute(tx)
+	if err == nil {
+		err = tx.commit()
+	}
+
+	if err != nil {
+		tx.restoreModels()
+		return err
+	}
+	return nil
+}
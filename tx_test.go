@@ -0,0 +1,73 @@
+package graphor
+
+import (
+	stderrors "errors"
+	"testing"
+)
+
+var errTestRollback = stderrors.New("rollback")
+
+func TestTransactionRetry(t *testing.T) {
+	c := newTestClient()
+	users := saveTestUsers(t, c, "alice")
+	schema := testUserSchema()
+
+	// increment reads age and saves it + 1; the first run conflicts with a concurrent increment.
+	runs := 0
+	err := c.Transaction(func(tx *Tx) error {
+		runs++
+
+		user, err := FindOne[*testUser](tx.BuildQuery(schema).Identify(users[0].GetUid()))
+		if err != nil {
+			return err
+		}
+
+		if runs == 1 {
+			concurrent := *users[0]
+			concurrent.Age = user.Age + 1
+			err := c.Mutate(func(m *Mutation) error {
+				return m.Save(&concurrent, schema)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		user.Age++
+		return tx.Save(user, schema)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 {
+		t.Errorf("Transaction() ran %d times, want 2", runs)
+	}
+
+	user, err := FindOne[*testUser](c.BuildQuery(schema).Identify(users[0].GetUid()))
+	if err != nil || user == nil || user.Age != 22 {
+		t.Errorf("FindOne() = %+v, %v; want age 22", user, err)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	c := newTestClient()
+	user := &testUser{Name: "alice"}
+
+	err := c.Transaction(func(tx *Tx) error {
+		if err := tx.Save(user, testUserSchema()); err != nil {
+			return err
+		}
+		return errTestRollback
+	})
+	if err != errTestRollback {
+		t.Fatalf("Transaction() = %v, want %v", err, errTestRollback)
+	}
+	if user.GetUid() != "" {
+		t.Errorf("uid = %q after rollback, want empty", user.GetUid())
+	}
+
+	count, err := c.BuildQuery(testUserSchema()).Count()
+	if err != nil || count != 0 {
+		t.Errorf("Count() = %d, %v; want 0", count, err)
+	}
+}
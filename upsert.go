@@ -0,0 +1,77 @@
+package graphor
+
+import (
+	"context"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func (g *Client) Upsert(model Model, schema Schema, keyFields ...string) error {
+	return g.UpsertContext(context.Background(), model, schema, keyFields...)
+}
+
+// UpsertContext saves model, updating the existing record which has the same values for keyFields if any.
+func (g *Client) UpsertContext(ctx context.Context, model Model, schema Schema, keyFields ...string) error {
+	return g.TransactionContext(ctx, func(tx *Tx) error {
+		return tx.Upsert(model, schema, keyFields...)
+	})
+}
+
+// Upsert looks up the record which has the same values for keyFields as model, and saves model onto it
+// (or as a new record if not found). The pinned dgo client has no upsert block, so query and mutation
+// run in the same transaction instead; concurrent upserts conflict and get retried, because key fields
+// must be declared with @upsert (Schema.Unique or FieldSchema.Upsert).
+func (tx *Tx) Upsert(model Model, schema Schema, keyFields ...string) error {
+	if model == nil {
+		return nil
+	}
+
+	for _, key := range keyFields {
+		if !schema.isUpsert(key) {
+			return errors.New(errors.InvalidUpsertKey, "Upsert failed: Key field must be declared with @upsert.").Add("key", key)
+		}
+	}
+
+	if !model.isEmpty() || len(keyFields) == 0 {
+		return tx.Save(model, schema)
+	}
+
+	all := toMap(model)
+
+	q := tx.BuildQuery(schema)
+	for _, key := range keyFields {
+		value, ok := all[key]
+		if !ok || isEmpty(value) {
+			return errors.New(errors.InvalidUpsertKey, "Upsert failed: Key field is empty.").Add("key", key)
+		}
+
+		q.Where(key, "eq", normalizeNumber(value))
+	}
+
+	data, err := q.FirstContext(tx.ctx)
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		tx.touch(model)
+		model.SetUid(decodeString(data["uid"]))
+		model.setCreatedAt(decodeInt(data["created_at"]))
+	}
+
+	return tx.Save(model, schema)
+}
+
+// isUpsert reports whether BaseMigrations declares field with @upsert.
+func (schema Schema) isUpsert(field string) bool {
+	if schema.FieldSchemas[field].Upsert {
+		return true
+	}
+
+	for _, name := range schema.Unique {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
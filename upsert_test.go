@@ -0,0 +1,70 @@
+package graphor
+
+import (
+	"testing"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+func TestUpsert(t *testing.T) {
+	c := newTestClient()
+	schema := testUserSchema()
+	schema.Unique = []string{"name"}
+
+	first := &testUser{Name: "alice", Age: 20}
+	if err := c.Upsert(first, schema, "name"); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &testUser{Name: "alice", Age: 30}
+	if err := c.Upsert(second, schema, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if second.GetUid() != first.GetUid() {
+		t.Errorf("Upsert() saved uid %s, want existing %s", second.GetUid(), first.GetUid())
+	}
+
+	count, err := c.BuildQuery(schema).Count()
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v; want 1", count, err)
+	}
+
+	err = c.Upsert(&testUser{Name: "bob", Age: 20}, schema, "age")
+	if !errors.HasCode(err, errors.InvalidUpsertKey) {
+		t.Errorf("Upsert() by key without @upsert = %v, want InvalidUpsertKey", err)
+	}
+}
+
+func TestUpsertRetryStartsFromOriginalModel(t *testing.T) {
+	c := newTestClient()
+	schema := testUserSchema()
+	schema.Unique = []string{"name"}
+	existing := saveTestUsers(t, c, "alice")[0]
+
+	user := &testUser{Name: "alice", Age: 30}
+	runs := 0
+	err := c.Transaction(func(tx *Tx) error {
+		runs++
+		if user.GetUid() != "" || user.GetCreatedAt() != 0 || user.GetUpdatedAt() != 0 {
+			t.Errorf("run %d started with uid %q, created_at %d, updated_at %d", runs, user.GetUid(), user.GetCreatedAt(), user.GetUpdatedAt())
+		}
+
+		if err := tx.Upsert(user, schema, "name"); err != nil {
+			return err
+		}
+
+		if runs == 1 {
+			// conflicts with the upsert, aborting the first run
+			return c.Mutate(func(m *Mutation) error {
+				return m.Save(existing, schema)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 || user.GetUid() != existing.GetUid() {
+		t.Errorf("Upsert() ran %d times and saved uid %s, want 2 runs and %s", runs, user.GetUid(), existing.GetUid())
+	}
+}
@@ -1,23 +1,40 @@
 package graphor
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nosukeru/graphor/errors"
 )
 
-func eval(x interface{}) string {
-	s := ""
+var (
+	uidPattern       = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+	tokenPattern     = regexp.MustCompile(`^~?[A-Za-z0-9_.]+(@[A-Za-z:-]+)?$`)
+	regexPattern     = regexp.MustCompile(`^/(?:[^/\\\n]|\\.)+/[a-z]*$`)
+	fieldNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+)
 
-	switch v := x.(type) {
-	case int:
-		s = fmt.Sprintf("%d", v)
-	case bool:
-		s = fmt.Sprintf("%t", v)
-	case string:
-		s = fmt.Sprintf("\"%s\"", v)
+// eval renders x as a JSON value of mutation. time.Time is rendered in RFC 3339 for datetime.
+// It fails for nil and values which can't be encoded into JSON.
+func eval(x interface{}) (string, bool) {
+	if x == nil {
+		return "", false
 	}
 
-	return s
+	b, err := json.Marshal(x)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
 
 func isEmpty(x interface{}) bool {
@@ -28,20 +45,77 @@ func isEmpty(x interface{}) bool {
 		return v == false
 	case string:
 		return v == ""
+	case int64:
+		return v == 0
+	case uint64:
+		return v == 0
+	case float64:
+		return v == 0
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case time.Time:
+		return v.IsZero()
+	case []string:
+		return len(v) == 0
 	}
 
 	return false
 }
 
+// normalizeNumber converts json.Number (decoded by toMap) to int64 or float64,
+// and integral float64 to int.
+func normalizeNumber(x interface{}) interface{} {
+	switch v := x.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v)
+		}
+	}
+	return x
+}
+
 func isValidUid(uids ...string) bool {
 	for _, uid := range uids {
-		if len(uid) < 2 || uid[0:2] != "0x" {
+		if !uidPattern.MatchString(uid) {
 			return false
 		}
 	}
 	return true
 }
 
+// isSafeToken reports whether s can be embedded into query text as is, e.g. predicate
+// (name, ~follow, name@en), function name or uid.
+func isSafeToken(s string) bool {
+	return tokenPattern.MatchString(s)
+}
+
+// isValidRegex reports whether s is a regular expression literal like /pattern/flags.
+func isValidRegex(s string) bool {
+	return regexPattern.MatchString(s)
+}
+
+func invalidQuery(method string, name string, value string) errors.Error {
+	return errors.New(errors.InvalidQuery, fmt.Sprintf("%s failed: Invalid %s.", method, name)).Add(name, value)
+}
+
+func reverseEdge(edge string) string {
+	if edge[0] == '~' {
+		return edge[1:]
+	}
+	return "~" + edge
+}
+
+func isReversed(edge string) bool {
+	return edge[0] == '~'
+}
+
 func keyExists(hash map[string]interface{}, key string) bool {
 	_, ok := hash[key]
 	return ok
@@ -52,6 +126,17 @@ func cast(src interface{}, dist interface{}) {
 	json.Unmarshal(j, dist)
 }
 
+// toMap converts obj into a map as JSON, keeping numbers as json.Number so that int64 values are not rounded.
+func toMap(obj interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(toJSON(obj))))
+	decoder.UseNumber()
+	decoder.Decode(&m)
+
+	return m
+}
+
 func toJSON(obj interface{}) string {
 	b, _ := json.Marshal(obj)
 	return string(b)
@@ -62,5 +147,37 @@ func decodeString(x interface{}) string {
 }
 
 func decodeInt(x interface{}) int {
-	return int(x.(float64))
+	switch v := x.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return int(f)
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+func decodeFloat(x interface{}) float64 {
+	switch v := x.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// decodeTime decodes datetime in RFC 3339, returning zero time if x is not a datetime.
+func decodeTime(x interface{}) time.Time {
+	s, _ := x.(string)
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
 }
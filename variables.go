@@ -0,0 +1,105 @@
+package graphor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nosukeru/graphor/errors"
+)
+
+// Raw is an arg of BuildRawQuery which is spliced into the query as is (e.g. Raw("orderasc: name")).
+// Never build it from user input.
+type Raw string
+
+// variables collects GraphQL+- query variables, so that values are never spliced into query text.
+type variables struct {
+	Decls  []string          // e.g. "$v0: string"
+	Values map[string]string // e.g. "$v0" -> "alice"
+}
+
+func newVariables() *variables {
+	return &variables{
+		Decls:  []string{},
+		Values: map[string]string{},
+	}
+}
+
+// add registers value as a new variable and returns its name.
+// []string is added as a list of variables (e.g. "[$v0, $v1]").
+// Values of types not listed in variable are rejected with InvalidQuery.
+func (v *variables) add(value interface{}) (string, error) {
+	if list, ok := value.([]string); ok {
+		names := []string{}
+		for _, s := range list {
+			name, _ := v.add(s)
+			names = append(names, name)
+		}
+		return "[" + strings.Join(names, ", ") + "]", nil
+	}
+
+	typ, s, err := variable(value)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("$v%d", len(v.Decls))
+	v.Decls = append(v.Decls, fmt.Sprintf("%s: %s", name, typ))
+	v.Values[name] = s
+	return name, nil
+}
+
+func (v *variables) clone() *variables {
+	res := newVariables()
+	res.Decls = append(res.Decls, v.Decls...)
+	for name, value := range v.Values {
+		res.Values[name] = value
+	}
+	return res
+}
+
+// declare prepends the query header declaring variables to q, e.g. "query q($v0: string) { ... }".
+func (v *variables) declare(q string) string {
+	if len(v.Decls) == 0 {
+		return q
+	}
+
+	return fmt.Sprintf("query q(%s) %s", strings.Join(v.Decls, ", "), strings.TrimSpace(q))
+}
+
+// variable returns GraphQL+- type and string representation of value.
+func variable(value interface{}) (string, string, error) {
+	switch v := value.(type) {
+	case int:
+		return "int", strconv.Itoa(v), nil
+	case int64:
+		return "int", strconv.FormatInt(v, 10), nil
+	case uint64:
+		return "int", strconv.FormatUint(v, 10), nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "int", v.String(), nil
+		}
+		return "float", v.String(), nil
+	case time.Time:
+		return "string", v.Format(time.RFC3339Nano), nil // compared as datetime
+	case bool:
+		return "bool", strconv.FormatBool(v), nil
+	case float64:
+		return "float", formatFloat(v), nil
+	case string:
+		return "string", v, nil
+	}
+
+	return "", "", errors.New(errors.InvalidQuery, "Unsupported type of value.").Add("type", fmt.Sprintf("%T", value)).Add("value", fmt.Sprint(value))
+}
+
+// uidList formats uids as a variable value for uid function.
+func uidList(uids []string) string {
+	if len(uids) == 1 {
+		return uids[0]
+	}
+	return "[" + strings.Join(uids, ", ") + "]"
+}